@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/bhmj/sqlsync/model"
+	"github.com/bhmj/sqlsync/syncer"
+)
+
+// dryRun runs every scheduled pair once writing Dest payloads and RVs to output (stdout by default)
+// instead of storing them
+func dryRun(settings *model.Settings, output string, log *slog.Logger) error {
+	w := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	failed, total := 0, 0
+	for _, pair := range settings.Sync {
+		if pair.Origin == nil { // push-only
+			continue
+		}
+		total++
+		if err := syncer.DryRun(context.Background(), pair, w, log); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pairs failed", failed, total)
+	}
+	log.Info("dry run completed", "pairs", total)
+	return nil
+}
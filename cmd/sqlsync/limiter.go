@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// limiter bounds the number of concurrent runs globally and per connection.
+// Limits are taken on first use and kept until restart.
+type limiter struct {
+	settings *model.Settings
+	global   chan struct{} // nil if unlimited
+	mu       sync.Mutex
+	links    map[string]chan struct{} // by ConnString
+}
+
+func newLimiter(settings *model.Settings) *limiter {
+	l := &limiter{settings: settings, links: make(map[string]chan struct{})}
+	settings.RLock()
+	defer settings.RUnlock()
+	if settings.MaxConcurrency != nil && *settings.MaxConcurrency > 0 {
+		l.global = make(chan struct{}, *settings.MaxConcurrency)
+	}
+	return l
+}
+
+// slots are semaphores of a run, taken in order
+type slots struct {
+	sems  []chan struct{}
+	taken int
+}
+
+// Acquire waits for the slots not taken yet. On cancel all the slots are released.
+func (s *slots) Acquire(ctx context.Context) error {
+	for s.taken < len(s.sems) {
+		select {
+		case s.sems[s.taken] <- struct{}{}:
+			s.taken++
+		case <-ctx.Done():
+			s.Release()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Release frees the slots taken
+func (s *slots) Release() {
+	for ; s.taken > 0; s.taken-- {
+		<-s.sems[s.taken-1]
+	}
+}
+
+// acquire waits for free slots of the pair connections and then for a global one.
+// Connection slots are taken in ConnString order, so pairs sharing connections do not deadlock.
+func (l *limiter) acquire(ctx context.Context, pair *model.SyncPair) (*slots, error) {
+	s := &slots{sems: l.sems(pair)}
+	if l.global != nil {
+		s.sems = append(s.sems, l.global)
+	}
+	return s, s.Acquire(ctx)
+}
+
+// sems returns limited connection semaphores of a pair sorted by ConnString
+func (l *limiter) sems(pair *model.SyncPair) []chan struct{} {
+	// links may be changed by reload
+	l.settings.RLock()
+	pairLinks := []*model.DBConnection{pair.SourceLink, pair.TargetLink}
+	l.settings.RUnlock()
+	links := make([]*model.DBConnection, 0, 2)
+	for _, link := range pairLinks {
+		if link != nil && link.MaxRuns > 0 && (len(links) == 0 || links[0].ConnString != link.ConnString) {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ConnString < links[j].ConnString })
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sems := make([]chan struct{}, 0, len(links)+1)
+	for _, link := range links {
+		sem, ok := l.links[link.ConnString]
+		if !ok {
+			sem = make(chan struct{}, link.MaxRuns)
+			l.links[link.ConnString] = sem
+		}
+		sems = append(sems, sem)
+	}
+	return sems
+}
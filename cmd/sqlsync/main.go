@@ -6,76 +6,172 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/bhmj/sqlsync/config"
+	"github.com/bhmj/sqlsync/server"
 	"github.com/bhmj/sqlsync/syncer"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
 
 	configFile := flag.String("config", "", "path to config file")
-	quietMode := flag.Bool("quiet", false, "do not write sync statistics")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn, error")
+	logFormat := flag.String("log-format", "text", "log format: text, json")
+	logOutput := flag.String("log-output", "stderr", "log output: stderr, stdout or file path")
+	watchInterval := flag.Duration("watch", 0, "reload config when the file changes, checked with this interval (disabled by default)")
+	dryRunFlag := flag.Bool("dry-run", false, "run every pair once and print what would be written, without writing to targets")
+	dryRunOutput := flag.String("dry-run-output", "", "write dry run output to this file instead of stdout")
 	flag.Parse()
 	if configFile == nil || *configFile == "" || !FileExists(*configFile) {
 		fmt.Fprintf(os.Stderr, "Usage: sqlsync [params] \n")
 		flag.PrintDefaults()
 		return
 	}
-	if *quietMode {
-		fmt.Println("quiet mode")
+	log, err := newLogger(*logLevel, *logFormat, *logOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: %s\n", err.Error())
+		return
 	}
 
-	settings, err := config.ReadConfig(*configFile)
+	settings, err := config.ReadConfig(*configFile, log)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "ReadConfig: %s\n", err.Error())
+		log.Error("ReadConfig failed", "err", err)
+		return
+	}
+
+	err = syncer.Connect(settings.Link, log)
+	if err != nil {
+		log.Error("Connect failed", "err", err)
+		return
+	}
+	defer func() {
+		// links may be replaced by reload
+		settings.RLock()
+		defer settings.RUnlock()
+		syncer.Disconnect(settings.Link)
+	}()
+
+	if *dryRunFlag {
+		err = dryRun(settings, *dryRunOutput, log)
+		if err != nil {
+			log.Error("dry run failed", "err", err)
+			syncer.Disconnect(settings.Link) // deferred calls are skipped by Exit
+			os.Exit(1)
+		}
 		return
 	}
 
 	// init RVs
-	for i := 0; i < len(settings.Sync); i++ {
-		syncer.Init(&settings.Sync[i])
+	for _, pair := range settings.Sync {
+		if pair.Origin != nil {
+			syncer.Init(pair, log)
+		}
 	}
 
+	// ctx cancellation stops scheduling and running syncs at their next RV checkpoint
 	ctx, cancel := context.WithCancel(context.Background())
 	errs := make(chan error, 32)
-	shutdown := make(chan bool, 1)
+	var running sync.WaitGroup
 
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		errs <- fmt.Errorf("%s", <-c)
+		// second signal while draining
+		log.Error("shutdown interrupted, running syncs aborted", "signal", (<-c).String())
+		os.Exit(1)
 	}()
 
+	if settings.Listen != nil && *settings.Listen != "" {
+		srv := server.New(*settings.Listen, settings, log)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			log.Info("listening", "addr", *settings.Listen)
+			if err := srv.Run(ctx); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	limit := newLimiter(settings)
+	sched := newScheduler(ctx, settings, log)
+	for _, pair := range settings.Sync {
+		sched.add(pair)
+	}
+
+	reloads := make(chan struct{}, 1)
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		for range c {
+			reloads <- struct{}{}
+		}
+	}()
+	if *watchInterval > 0 {
+		go watch(*configFile, *watchInterval, reloads)
+	}
 	go func() {
-		fmt.Printf("\nshutting down on %v\n", <-errs)
-		cancel()
-		time.Sleep(200 * time.Millisecond)
-		shutdown <- true
+		for range reloads {
+			err := reload(*configFile, settings, sched, log)
+			if err != nil {
+				log.Error("reload failed, keeping current config", "err", err)
+			}
+		}
 	}()
 
-	jobs := make(chan int)
+	log.Info("started")
+loop:
+	for {
+		select {
+		case err := <-errs:
+			log.Info("shutting down", "reason", err)
+			break loop
+		case job := <-sched.jobs:
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				slots, err := limit.acquire(job.ctx, job.pair)
+				if err != nil { // cancelled while waiting
+					job.done(err)
+					return
+				}
+				err = syncer.DoSync(syncer.WithSlots(job.ctx, slots), job.pair, log)
+				slots.Release()
+				job.done(err)
+			}()
+		}
+	}
 
-	for i := 0; i < len(settings.Sync); i++ {
-		fmt.Printf("adding %s (%s)\n", *settings.Sync[i].Origin, settings.Sync[i].Period.Duration)
-		go func(sync int) {
-			for {
-				jobs <- sync
-				time.Sleep(settings.Sync[sync].Period.Duration)
-			}
-		}(i)
+	// drain
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	settings.RLock()
+	timeout := defaultShutdownTimeout
+	if settings.ShutdownTimeout != nil && settings.ShutdownTimeout.Duration > 0 {
+		timeout = settings.ShutdownTimeout.Duration
 	}
-	fmt.Println("started")
-	for {
+	settings.RUnlock()
+	select {
+	case <-done:
+	case <-time.After(timeout):
 		select {
-		case <-shutdown:
-			fmt.Println("terminated")
-			os.Exit(0)
-		case sync := <-jobs:
-			go syncer.DoSync(ctx, &settings.Sync[sync], *quietMode)
+		case <-done: // finished just in time
+		default:
+			log.Error("shutdown timed out, running syncs aborted", "timeout", timeout.String())
+			os.Exit(1)
 		}
 	}
+	log.Info("terminated")
 }
 
 // FileExists ...
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/bhmj/sqlsync/config"
+	"github.com/bhmj/sqlsync/model"
+	"github.com/bhmj/sqlsync/syncer"
+)
+
+// reload re-reads config file and applies it to running settings.
+// Pairs are matched by Name: new pairs are added, removed ones are stopped and
+// the rest are updated in place keeping their in-memory RVs. Pairs with changed
+// Origin, connections, SyncTable or DependsOn are replaced once their running syncs finish.
+// Pool settings of reused connections are applied in place.
+// On error the current config stays in effect.
+func reload(fname string, settings *model.Settings, sched *scheduler, log *slog.Logger) error {
+	fresh, err := config.ReadConfig(fname, log)
+	if err != nil {
+		return err
+	}
+
+	// reuse open connection pools
+	settings.RLock()
+	current := make(map[string]*model.DBConnection)
+	for _, link := range settings.Link {
+		current[link.ConnString] = link
+	}
+	old := make(map[string]*model.SyncPair)
+	for _, pair := range settings.Sync {
+		old[pair.Name] = pair
+	}
+	listen := settings.Listen
+	maxConcurrency := settings.MaxConcurrency
+	settings.RUnlock()
+
+	links := make(map[string]*model.DBConnection)
+	opened := make([]*model.DBConnection, 0)
+	reused := make(map[*model.DBConnection]*model.DBConnection) // current -> fresh
+	for i, link := range fresh.Link {
+		if cur, ok := current[link.ConnString]; ok {
+			reused[cur] = link
+			fresh.Link[i] = cur
+			delete(current, link.ConnString)
+		} else {
+			opened = append(opened, link)
+		}
+		links[link.ConnString] = fresh.Link[i]
+	}
+	err = syncer.Connect(opened, log)
+	if err != nil {
+		syncer.Disconnect(opened)
+		return err
+	}
+	for cur, link := range reused {
+		updateLink(cur, link, settings, log)
+	}
+	for _, pair := range fresh.Sync {
+		relink(pair, links)
+	}
+
+	pairs := make([]*model.SyncPair, 0, len(fresh.Sync))
+	added := make([]*model.SyncPair, 0)
+	for _, pair := range fresh.Sync {
+		if cur, ok := old[pair.Name]; ok && samePair(cur, pair) {
+			updatePair(cur, pair, settings, log)
+			sched.update(cur.Name)
+			pairs = append(pairs, cur)
+			delete(old, pair.Name)
+			continue
+		}
+		pairs = append(pairs, pair)
+		added = append(added, pair)
+	}
+
+	// replacements start once the runs of old pairs are over,
+	// so they read the RVs stored by the last run and never overlap it
+	for name, pair := range old {
+		sched.remove(name)
+		retire(pair)
+	}
+	for _, pair := range added {
+		if pair.Origin != nil {
+			syncer.Init(pair, log)
+		}
+	}
+	settings.Lock()
+	settings.Sync = pairs
+	settings.Link = fresh.Link
+	settings.Source = fresh.Source
+	settings.Target = fresh.Target
+	settings.LivenessPeriods = fresh.LivenessPeriods
+	settings.ShutdownTimeout = fresh.ShutdownTimeout
+	settings.Unlock()
+	for _, pair := range added {
+		sched.add(pair)
+	}
+
+	if !sameString(listen, fresh.Listen) {
+		log.Warn("Listen change requires restart")
+	}
+	if !sameInt(maxConcurrency, fresh.MaxConcurrency) {
+		log.Warn("MaxConcurrency change requires restart")
+	}
+	// pools no longer used: pairs using them are retired
+	for _, link := range current {
+		if link.DB != nil {
+			link.DB.Close()
+		}
+	}
+	log.Info("config reloaded", "pairs", len(pairs), "added", len(added), "removed", len(old))
+	return nil
+}
+
+// retire waits for a running sync of a replaced or removed pair to finish.
+// Runs of the pair dispatched or pushed later do nothing.
+func retire(pair *model.SyncPair) {
+	pair.Lock()
+	pair.Retired = true
+	pair.Unlock()
+}
+
+// updateLink applies pool settings of fresh link to a reused one.
+// Connection limiter slots are kept until restart.
+func updateLink(cur, fresh *model.DBConnection, settings *model.Settings, log *slog.Logger) {
+	if cur.MaxRuns != fresh.MaxRuns {
+		log.Warn("connection MaxConcurrency change requires restart", "type", cur.Type)
+	}
+	if cur.MaxOpen == fresh.MaxOpen && cur.MaxIdle == fresh.MaxIdle && cur.MaxLifetime == fresh.MaxLifetime {
+		return
+	}
+	settings.Lock()
+	cur.MaxOpen, cur.MaxIdle, cur.MaxLifetime = fresh.MaxOpen, fresh.MaxIdle, fresh.MaxLifetime
+	settings.Unlock()
+	if cur.DB != nil {
+		cur.DB.SetMaxOpenConns(cur.MaxOpen)
+		cur.DB.SetMaxIdleConns(cur.MaxIdle)
+		cur.DB.SetConnMaxLifetime(cur.MaxLifetime)
+	}
+	log.Info("connection pool settings updated", "type", cur.Type)
+}
+
+// relink points pair (and its row procs) to shared connection pools
+func relink(pair *model.SyncPair, links map[string]*model.DBConnection) {
+	if pair.SourceLink != nil {
+		pair.SourceLink = links[pair.SourceLink.ConnString]
+	}
+	if pair.TargetLink != nil {
+		pair.TargetLink = links[pair.TargetLink.ConnString]
+	}
+	for p := range pair.RowProc {
+		for s := range pair.RowProc[p].Sync {
+			relink(&pair.RowProc[p].Sync[s], links)
+		}
+	}
+}
+
+// samePair reports whether fresh pair config may be applied to a running pair in place
+func samePair(cur, fresh *model.SyncPair) bool {
+	return sameString(cur.Origin, fresh.Origin) &&
+		sameString(cur.SyncTable, fresh.SyncTable) && cur.SyncTableSide == fresh.SyncTableSide &&
+		sameLink(cur.SourceLink, fresh.SourceLink) && sameLink(cur.TargetLink, fresh.TargetLink) &&
+		sameStrings(cur.DependsOn, fresh.DependsOn)
+}
+
+// updatePair copies config of fresh pair to running pair keeping RVs of known params.
+// Waits for a run in progress to finish.
+func updatePair(cur, fresh *model.SyncPair, settings *model.Settings, log *slog.Logger) {
+	cur.Lock()
+	defer cur.Unlock()
+
+	values := make(map[string]int64)
+	for _, p := range cur.ColumnParam {
+		values[p.Param] = p.Value
+	}
+	newParams := false
+	for i := range fresh.ColumnParam {
+		if v, ok := values[fresh.ColumnParam[i].Param]; ok {
+			fresh.ColumnParam[i].Value = v
+		} else {
+			newParams = true
+		}
+	}
+
+	settings.Lock()
+	cur.Source = fresh.Source
+	cur.Target = fresh.Target
+	cur.Dest = fresh.Dest
+	cur.Key = fresh.Key
+	cur.Method = fresh.Method
+	cur.Body = fresh.Body
+	cur.Select = fresh.Select
+	cur.ColumnParam = fresh.ColumnParam
+	cur.Mapping = fresh.Mapping
+	cur.RowProc = fresh.RowProc
+	cur.Bulk = fresh.Bulk
+	cur.BatchSize = fresh.BatchSize
+	cur.Retry = fresh.Retry
+	cur.SourceLink = fresh.SourceLink
+	cur.TargetLink = fresh.TargetLink
+	cur.Period = fresh.Period
+	cur.Schedule = fresh.Schedule
+	cur.Overlap = fresh.Overlap
+	cur.TableType = fresh.TableType
+	cur.OriginTable = fresh.OriginTable
+	cur.DestTable = fresh.DestTable
+	settings.Unlock()
+
+	if newParams && cur.Origin != nil {
+		syncer.Init(cur, log)
+	}
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameLink(a, b *model.DBConnection) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ConnString == b.ConnString
+}
+
+// watch sends to reloads when config file modification time changes
+func watch(fname string, interval time.Duration, reloads chan<- struct{}) {
+	var mtime time.Time
+	if fi, err := os.Stat(fname); err == nil {
+		mtime = fi.ModTime()
+	}
+	for range time.Tick(interval) {
+		fi, err := os.Stat(fname)
+		if err != nil || fi.ModTime().Equal(mtime) {
+			continue
+		}
+		mtime = fi.ModTime()
+		reloads <- struct{}{}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bhmj/sqlsync/metrics"
+	"github.com/bhmj/sqlsync/model"
+)
+
+// overlap policies
+const (
+	overlapSkip   = "skip"   // drop the tick
+	overlapQueue  = "queue"  // run once more after the current run
+	overlapCancel = "cancel" // stop the current run at its next checkpoint and run again
+)
+
+// job is a scheduled run of a pair. done must be called with the run result when the run is over.
+type job struct {
+	ctx  context.Context
+	pair *model.SyncPair
+	done func(error)
+}
+
+// scheduler runs a goroutine per pair which sends due runs to jobs.
+// A pair never has more than one run in progress.
+// Pairs with DependsOn run when all their parents have succeeded since their previous run.
+type scheduler struct {
+	ctx      context.Context
+	settings *model.Settings
+	jobs     chan job
+	mu       sync.Mutex
+	timers   map[string]pairTimer
+	parents  map[string][]string        // dependent -> parents
+	ready    map[string]map[string]bool // dependent -> parents succeeded in the current cycle
+	log      *slog.Logger
+}
+
+type pairTimer struct {
+	stop    context.CancelFunc
+	wake    chan struct{} // schedule changed
+	trigger chan struct{} // parents succeeded
+}
+
+// pairState tracks the run in progress
+type pairState struct {
+	running bool
+	started time.Time
+	queued  bool
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+func newScheduler(ctx context.Context, settings *model.Settings, log *slog.Logger) *scheduler {
+	return &scheduler{
+		ctx:      ctx,
+		settings: settings,
+		jobs:     make(chan job),
+		timers:   make(map[string]pairTimer),
+		parents:  make(map[string][]string),
+		ready:    make(map[string]map[string]bool),
+		log:      log,
+	}
+}
+
+// add starts scheduling a pair. Push-only pairs are not scheduled.
+// Pairs with Period start immediately, pairs with Schedule wait for the first activation,
+// pairs with DependsOn wait for their parents.
+func (s *scheduler) add(pair *model.SyncPair) {
+	switch {
+	case pair.Origin == nil:
+		s.log.Info("adding pair", "pair", pair.Name, "push_only", true)
+		return
+	case len(pair.DependsOn) > 0:
+		s.log.Info("adding pair", "pair", pair.Name, "depends_on", pair.DependsOn)
+	case pair.Schedule != nil && pair.Schedule.Cron != "":
+		s.log.Info("adding pair", "pair", pair.Name, "cron", pair.Schedule.Cron)
+	default:
+		s.log.Info("adding pair", "pair", pair.Name, "period", pair.Period.Duration.String())
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	t := pairTimer{stop: cancel, wake: make(chan struct{}, 1), trigger: make(chan struct{}, 1)}
+	s.mu.Lock()
+	s.timers[pair.Name] = t
+	if len(pair.DependsOn) > 0 {
+		s.parents[pair.Name] = pair.DependsOn
+		s.ready[pair.Name] = make(map[string]bool)
+	}
+	s.mu.Unlock()
+	go s.loop(ctx, pair, t)
+}
+
+// loop fires pair runs on schedule or on trigger applying overlap policy
+func (s *scheduler) loop(ctx context.Context, pair *model.SyncPair, t pairTimer) {
+	// buffered: the run may end after the pair is removed
+	st := &pairState{done: make(chan error, 1)}
+	dependent := len(pair.DependsOn) > 0
+	var prev, next time.Time
+	if !dependent {
+		next = s.next(pair, prev)
+	}
+	for {
+		var timer <-chan time.Time // nil for dependent pairs
+		if !dependent {
+			if next.IsZero() {
+				s.log.Warn("no more scheduled runs", "pair", pair.Name)
+				return
+			}
+			timer = time.After(time.Until(next))
+		}
+		select {
+		case <-timer:
+			if !s.tick(ctx, pair, st) {
+				return
+			}
+			prev = next
+			next = s.next(pair, prev)
+			s.log.Debug("next run", "pair", pair.Name, "at", next)
+		case <-t.trigger:
+			if !s.tick(ctx, pair, st) {
+				return
+			}
+		case <-t.wake:
+			if !dependent {
+				next = s.next(pair, prev)
+			}
+		case err := <-st.done:
+			st.running = false
+			s.finished(pair.Name, err)
+			if st.queued {
+				st.queued = false
+				if !s.start(ctx, pair, st) {
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tick starts a run or applies overlap policy if the pair is still running.
+// Returns false if the pair is stopped.
+func (s *scheduler) tick(ctx context.Context, pair *model.SyncPair, st *pairState) bool {
+	if !st.running {
+		return s.start(ctx, pair, st)
+	}
+	s.settings.RLock()
+	policy := overlapSkip
+	if pair.Overlap != nil {
+		policy = *pair.Overlap
+	}
+	s.settings.RUnlock()
+
+	missed := policy == overlapSkip || st.queued
+	switch policy {
+	case overlapCancel:
+		st.cancel()
+		st.queued = true
+	case overlapQueue:
+		st.queued = true
+	}
+	if missed {
+		metrics.MissedTick(pair.Name)
+		s.log.Warn("tick missed, previous run in progress", "pair", pair.Name, "policy", policy,
+			"running", time.Since(st.started).Round(time.Millisecond).String())
+	} else {
+		s.log.Info("previous run in progress", "pair", pair.Name, "policy", policy,
+			"running", time.Since(st.started).Round(time.Millisecond).String())
+	}
+	return true
+}
+
+// start sends a pair run to jobs. Returns false if the pair is stopped.
+// A removed pair is not interrupted: the run context derives from the scheduler one.
+func (s *scheduler) start(ctx context.Context, pair *model.SyncPair, st *pairState) bool {
+	runCtx, cancel := context.WithCancel(s.ctx)
+	j := job{ctx: runCtx, pair: pair, done: func(err error) {
+		cancel()
+		st.done <- err
+	}}
+	select {
+	case s.jobs <- j:
+		st.running, st.started, st.cancel = true, time.Now(), cancel
+		return true
+	case <-ctx.Done():
+		cancel()
+		return false
+	}
+}
+
+// next returns the activation of a pair following prev (zero for the first one).
+// Activations missed while waiting are skipped.
+func (s *scheduler) next(pair *model.SyncPair, prev time.Time) time.Time {
+	// Period and Schedule may be changed by reload
+	s.settings.RLock()
+	defer s.settings.RUnlock()
+	now := time.Now()
+	if pair.Schedule != nil {
+		if !prev.IsZero() {
+			if next := pair.Schedule.Next(prev); next.After(now) {
+				return next
+			}
+		}
+		return pair.Schedule.Next(now)
+	}
+	if prev.IsZero() {
+		return now
+	}
+	period := pair.Period.Duration
+	next := prev.Add(period)
+	if next.Before(now) {
+		next = next.Add((now.Sub(next)/period + 1) * period)
+	}
+	return next
+}
+
+// finished records the result of a pair run for its dependents and triggers those
+// whose parents have all succeeded. A failed run drops the parent from the current cycle.
+func (s *scheduler) finished(name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for dependent, parents := range s.parents {
+		if !contains(parents, name) {
+			continue
+		}
+		ready := s.ready[dependent]
+		if err != nil {
+			if ready[name] {
+				s.log.Info("parent failed, dependent pair postponed", "pair", dependent, "parent", name)
+			}
+			delete(ready, name)
+			continue
+		}
+		ready[name] = true
+		if len(ready) < len(parents) {
+			continue
+		}
+		s.ready[dependent] = make(map[string]bool)
+		select {
+		case s.timers[dependent].trigger <- struct{}{}:
+		default: // already triggered
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// update makes a pair recalculate its next run after schedule change
+func (s *scheduler) update(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[name]; ok {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// remove stops scheduling a pair. A run in progress is not interrupted.
+func (s *scheduler) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[name]; ok {
+		s.log.Info("removing pair", "pair", name)
+		t.stop()
+		delete(s.timers, name)
+		delete(s.parents, name)
+		delete(s.ready, name)
+	}
+}
@@ -3,43 +3,100 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"regexp"
+	"strings"
 
 	"github.com/bhmj/sqlsync/model"
 )
 
+const tablePrefix = "table:"
+
 // ReadConfig reads config
-func ReadConfig(fname string) (cfg *model.Settings, err error) {
+func ReadConfig(fname string, log *slog.Logger) (cfg *model.Settings, err error) {
 
-	println("reading", fname)
-	conf, err := os.Open(fname)
+	log.Info("reading config", "file", fname)
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return
+	}
+	data, err = expandEnv(data)
 	if err != nil {
 		return
 	}
-	defer conf.Close()
 
-	jsonParser := json.NewDecoder(conf)
 	cfg = &model.Settings{}
-	err = jsonParser.Decode(cfg)
+	err = json.Unmarshal(data, cfg)
 	if err != nil {
 		return
 	}
 
-	return cfg, ValidateConfig(cfg)
+	err = ValidateConfig(cfg)
+	if err != nil {
+		return
+	}
+	log.Debug("config loaded", "pairs", len(cfg.Sync), "links", len(cfg.Link))
+	return cfg, nil
 }
 
 // ValidateConfig ...
 func ValidateConfig(cfg *model.Settings) error {
 
+	if cfg.LivenessPeriods != nil && *cfg.LivenessPeriods < 1 {
+		return fmt.Errorf("LivenessPeriods must be positive")
+	}
+	if cfg.MaxConcurrency != nil && *cfg.MaxConcurrency < 0 {
+		return fmt.Errorf("MaxConcurrency must not be negative")
+	}
+	if cfg.ShutdownTimeout != nil && cfg.ShutdownTimeout.Duration <= 0 {
+		return fmt.Errorf("ShutdownTimeout must be positive")
+	}
+	names := make(map[string]bool)
 	for i := 0; i < len(cfg.Sync); i++ {
-		conns, err := CheckPair(cfg.Sync[i].Source, cfg.Sync[i].Target, cfg.Source, cfg.Target)
+		// push-only pair has no Origin
+		if cfg.Sync[i] == nil {
+			return fmt.Errorf("empty sync pair")
+		}
+		pushOnly := cfg.Sync[i].Origin == nil
+		cfg.Sync[i].Source = mergeServer(cfg.Sync[i].Source, cfg.Source)
+		cfg.Sync[i].Target = mergeServer(cfg.Sync[i].Target, cfg.Target)
+		parseOrigin(cfg.Sync[i])
+		if cfg.Sync[i].Name == "" {
+			if pushOnly {
+				return fmt.Errorf("Name is required for a pair without Origin")
+			}
+			cfg.Sync[i].Name = *cfg.Sync[i].Origin
+		}
+		if r := cfg.Sync[i].Retry; r != nil && (r.Attempts < 0 ||
+			r.Backoff != nil && r.Backoff.Duration < 0 || r.MaxBackoff != nil && r.MaxBackoff.Duration < 0) {
+			return fmt.Errorf("invalid Retry policy: %s", cfg.Sync[i].Name)
+		}
+		if !pushOnly {
+			if err := parseSchedule(cfg.Sync[i]); err != nil {
+				return err
+			}
+		} else if len(cfg.Sync[i].DependsOn) > 0 {
+			return fmt.Errorf("DependsOn is not supported for a pair without Origin: %s", cfg.Sync[i].Name)
+		}
+		if names[cfg.Sync[i].Name] {
+			return fmt.Errorf("duplicate pair name: %s", cfg.Sync[i].Name)
+		}
+		names[cfg.Sync[i].Name] = true
+		var conns [2]string
+		var err error
+		if pushOnly {
+			conns[1], err = makeConn(cfg.Sync[i].Target)
+		} else {
+			conns, err = CheckPair(cfg.Sync[i].Source, cfg.Sync[i].Target, cfg.Source, cfg.Target)
+		}
 		if err != nil {
 			return err
 		}
-		cfg.Sync[i].Source.Type = coalesceString(cfg.Sync[i].Source.Type, cfg.Source.Type)
-		cfg.Sync[i].Target.Type = coalesceString(cfg.Sync[i].Target.Type, cfg.Target.Type)
 		for c := 0; c < len(conns); c++ {
+			if c == 0 && pushOnly {
+				continue
+			}
 			found := -1
 			for k := 0; k < len(cfg.Link); k++ {
 				if cfg.Link[k].ConnString == conns[c] {
@@ -48,29 +105,37 @@ func ValidateConfig(cfg *model.Settings) error {
 				}
 			}
 			if found == -1 {
-				cfg.Link = append(cfg.Link, model.DBConnection{ConnString: conns[c]})
+				srv := cfg.Sync[i].Source
+				if c == 1 {
+					srv = cfg.Sync[i].Target
+				}
+				cfg.Link = append(cfg.Link, makeLink(conns[c], srv))
 				found = len(cfg.Link) - 1
 			}
 			if c == 0 {
-				cfg.Sync[i].SourceLink = &cfg.Link[found]
+				cfg.Sync[i].SourceLink = cfg.Link[found]
 			} else {
-				cfg.Sync[i].TargetLink = &cfg.Link[found]
+				cfg.Sync[i].TargetLink = cfg.Link[found]
 			}
 		}
 		// TODO: validate params
-		// propagate connections to row proc
-		for p := 0; p < len(cfg.Sync[i].RowProc); p++ {
-			for s := 0; s < len(cfg.Sync[i].RowProc[p].Sync); s++ {
-				sub := &cfg.Sync[i].RowProc[p].Sync[s]
-				sub.Source = cfg.Sync[i].Source
-				sub.Target = cfg.Sync[i].Target
-				sub.SourceLink = cfg.Sync[i].SourceLink
-				sub.TargetLink = cfg.Sync[i].TargetLink
-			}
+		if cfg.Sync[i].OriginTable && *cfg.Sync[i].Source.Type == "http" {
+			return fmt.Errorf("table Origin is not supported for http source: %s", cfg.Sync[i].Name)
+		}
+		err = parseDest(cfg.Sync[i])
+		if err != nil {
+			return err
+		}
+		err = propagate(cfg.Sync[i])
+		if err != nil {
+			return err
 		}
 		// sync table parsing
 		s := "sync.sqlsync"
-		if cfg.Sync[i].SyncTable != nil {
+		if cfg.Sync[i].SyncTable == nil {
+			cfg.Sync[i].SyncTableSide = "dst"
+			cfg.Sync[i].SyncTable = &s
+		} else {
 			v1 := regexp.MustCompile(`^(src|dst)\.([\w\.]+)$`)
 			v2 := regexp.MustCompile(`^(src|dst)$`)
 			v3 := regexp.MustCompile(`^[\w+\.]+$`)
@@ -83,29 +148,111 @@ func ValidateConfig(cfg *model.Settings) error {
 				cfg.Sync[i].SyncTableSide = tokens[0]
 				cfg.Sync[i].SyncTable = &s
 			} else if v3.MatchString(*cfg.Sync[i].SyncTable) {
-				tokens := v2.FindStringSubmatch(*cfg.Sync[i].SyncTable)
+				tokens := v3.FindStringSubmatch(*cfg.Sync[i].SyncTable)
 				cfg.Sync[i].SyncTableSide = "dst"
 				cfg.Sync[i].SyncTable = &tokens[0]
 			} else {
 				return fmt.Errorf("invalid SyncTable: %s", *cfg.Sync[i].SyncTable)
 			}
 		}
-		// MS SQL table type support
-		cfg.Sync[i].TableType = make([]string, len(cfg.Sync[i].Dest))
-		mstt := regexp.MustCompile(`^([\w\.]+)\s+(@([\w\.]+))$`)
-		for d := 0; d < len(cfg.Sync[i].Dest); d++ {
-			if mstt.MatchString(*cfg.Sync[i].Dest[d]) {
-				tokens := mstt.FindStringSubmatch(*cfg.Sync[i].Dest[d])
-				cfg.Sync[i].Dest[d] = &tokens[1]
-				cfg.Sync[i].TableType[d] = tokens[3]
-			}
+		if cfg.Sync[i].SyncTableSide == "src" && (pushOnly || *cfg.Sync[i].Source.Type == "http") {
+			return fmt.Errorf("SyncTable cannot be on source side: %s", cfg.Sync[i].Name)
+		}
+		side := cfg.Sync[i].Target
+		if cfg.Sync[i].SyncTableSide == "src" {
+			side = cfg.Sync[i].Source
+		}
+		if cfg.Sync[i].SyncTable == &s && *side.Type == "sqlite" {
+			s = "sqlsync" // no schemas in SQLite
 		}
 		// TODO: validate ColumnParam in RowProc to 1) non-nil 2) match column names to parent column set
 		// TODO: validate Mapping in RowProc for @ columns to match to params
 	}
+	return checkDependencies(cfg.Sync)
+}
+
+// propagate connections to row proc
+func propagate(pair *model.SyncPair) error {
+	for p := 0; p < len(pair.RowProc); p++ {
+		for s := 0; s < len(pair.RowProc[p].Sync); s++ {
+			sub := &pair.RowProc[p].Sync[s]
+			sub.Source = pair.Source
+			sub.Target = pair.Target
+			sub.SourceLink = pair.SourceLink
+			sub.TargetLink = pair.TargetLink
+			if sub.Origin == nil {
+				return fmt.Errorf("Origin is required in RowProc of %s", pair.Name)
+			}
+			if sub.Name == "" {
+				sub.Name = *sub.Origin
+			}
+			parseOrigin(sub)
+			err := parseDest(sub)
+			if err != nil {
+				return err
+			}
+			err = propagate(sub)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseOrigin detects table Origin ("table:schema.name")
+func parseOrigin(pair *model.SyncPair) {
+	if pair.Origin == nil {
+		return
+	}
+	if strings.HasPrefix(*pair.Origin, tablePrefix) {
+		origin := strings.TrimPrefix(*pair.Origin, tablePrefix)
+		pair.Origin = &origin
+		pair.OriginTable = true
+	} else if isType(pair.Source, "sqlite") && !isStatement(*pair.Origin) {
+		pair.OriginTable = true
+	}
+}
+
+// parseDest detects table Dest ("table:schema.name") and MS SQL table types ("proc @TableType")
+func parseDest(pair *model.SyncPair) error {
+	pair.TableType = make([]string, len(pair.Dest))
+	pair.DestTable = make([]bool, len(pair.Dest))
+	mstt := regexp.MustCompile(`^([\w\.]+)\s+(@([\w\.]+))$`)
+	for d := 0; d < len(pair.Dest); d++ {
+		if strings.HasPrefix(*pair.Dest[d], tablePrefix) {
+			dest := strings.TrimPrefix(*pair.Dest[d], tablePrefix)
+			pair.Dest[d] = &dest
+			pair.DestTable[d] = true
+		} else if isType(pair.Target, "sqlite") && !isStatement(*pair.Dest[d]) {
+			pair.DestTable[d] = true
+		} else if mstt.MatchString(*pair.Dest[d]) {
+			tokens := mstt.FindStringSubmatch(*pair.Dest[d])
+			pair.Dest[d] = &tokens[1]
+			pair.TableType[d] = tokens[3]
+		}
+		if pair.DestTable[d] && len(pair.Key) == 0 && (isType(pair.Target, "postgres") || isType(pair.Target, "mssql")) {
+			return fmt.Errorf("Key is required for table Dest: %s", *pair.Dest[d])
+		}
+		if pair.Bulk != nil && pair.Bulk.Staging == nil && !pair.DestTable[d] && pair.TableType[d] == "" {
+			return fmt.Errorf("Bulk.Staging is required for procedure Dest: %s", *pair.Dest[d])
+		}
+	}
+	if pair.Bulk != nil && !isType(pair.Target, "postgres") && !isType(pair.Target, "mssql") {
+		return fmt.Errorf("Bulk is not supported for %s target", *pair.Target.Type)
+	}
 	return nil
 }
 
+func isType(srv model.DBServer, typ string) bool {
+	return srv.Type != nil && *srv.Type == typ
+}
+
+// isStatement reports whether Origin/Dest is an SQL statement rather than a name
+func isStatement(s string) bool {
+	return strings.ContainsAny(strings.TrimSpace(s), " \t\r\n")
+}
+
 // CheckPair ...
 func CheckPair(
 	left model.DBServer,
@@ -113,28 +260,75 @@ func CheckPair(
 	defLeft model.DBServer,
 	defRight model.DBServer,
 ) (conns [2]string, err error) {
-	typ := coalesceString(left.Type, defLeft.Type)
-	host := coalesceString(left.Host, defLeft.Host)
-	fovr := coalesceString(left.Failover, defLeft.Failover)
-	port := coalesceInt(left.Port, defLeft.Port)
-	db := coalesceString(left.DB, defLeft.DB)
-	user := coalesceString(left.User, defLeft.User)
-	pass := coalesceString(left.Password, defLeft.Password)
-	conns[0], err = makeConn(typ, host, fovr, port, db, user, pass)
+	conns[0], err = makeConn(mergeServer(left, defLeft))
 	if err != nil {
 		return
 	}
-	typ = coalesceString(right.Type, defRight.Type)
-	host = coalesceString(right.Host, defRight.Host)
-	fovr = coalesceString(right.Failover, defRight.Failover)
-	port = coalesceInt(right.Port, defRight.Port)
-	db = coalesceString(right.DB, defRight.DB)
-	user = coalesceString(right.User, defRight.User)
-	pass = coalesceString(right.Password, defRight.Password)
-	conns[1], err = makeConn(typ, host, fovr, port, db, user, pass)
+	right = mergeServer(right, defRight)
+	if right.Type != nil && *right.Type == "http" {
+		return conns, fmt.Errorf("http is supported as a source only")
+	}
+	conns[1], err = makeConn(right)
 	return
 }
 
+// mergeServer fills missing server fields from defaults
+func mergeServer(srv model.DBServer, def model.DBServer) model.DBServer {
+	srv.Type = coalesceString(srv.Type, def.Type)
+	srv.Host = coalesceString(srv.Host, def.Host)
+	srv.Failover = coalesceString(srv.Failover, def.Failover)
+	srv.Port = coalesceInt(srv.Port, def.Port)
+	srv.DB = coalesceString(srv.DB, def.DB)
+	srv.User = coalesceString(srv.User, def.User)
+	if srv.Password == nil && srv.PasswordFile == nil {
+		srv.Password = def.Password
+		srv.PasswordFile = def.PasswordFile
+	}
+	if srv.Headers == nil {
+		srv.Headers = def.Headers
+	}
+	if srv.Timeout == nil {
+		srv.Timeout = def.Timeout
+	}
+	srv.SSLMode = coalesceString(srv.SSLMode, def.SSLMode)
+	srv.SSLRootCert = coalesceString(srv.SSLRootCert, def.SSLRootCert)
+	srv.SSLCert = coalesceString(srv.SSLCert, def.SSLCert)
+	srv.SSLKey = coalesceString(srv.SSLKey, def.SSLKey)
+	srv.SSLServerName = coalesceString(srv.SSLServerName, def.SSLServerName)
+	srv.MaxOpenConns = coalesceInt(srv.MaxOpenConns, def.MaxOpenConns)
+	srv.MaxConcurrency = coalesceInt(srv.MaxConcurrency, def.MaxConcurrency)
+	srv.MaxIdleConns = coalesceInt(srv.MaxIdleConns, def.MaxIdleConns)
+	if srv.ConnMaxLifetime == nil {
+		srv.ConnMaxLifetime = def.ConnMaxLifetime
+	}
+	return srv
+}
+
+// makeLink creates connection with pool settings of the server
+func makeLink(conn string, srv model.DBServer) *model.DBConnection {
+	link := &model.DBConnection{ConnString: conn, Type: *srv.Type, MaxIdle: 2}
+	if srv.MaxOpenConns != nil {
+		link.MaxOpen = *srv.MaxOpenConns
+	}
+	if srv.MaxIdleConns != nil {
+		link.MaxIdle = *srv.MaxIdleConns
+	}
+	if srv.ConnMaxLifetime != nil {
+		link.MaxLifetime = srv.ConnMaxLifetime.Duration
+	}
+	if srv.MaxConcurrency != nil {
+		link.MaxRuns = *srv.MaxConcurrency
+	}
+	if srv.PasswordFile != nil && *srv.PasswordFile != "" {
+		// secret may be rotated: read it again on every new connection
+		link.DSN = func() (string, error) { return makeConn(srv) }
+	}
+	if link.Type == "postgres" && srv.Failover != nil && *srv.Failover != "" {
+		link.Hosts = append([]string{*srv.Host}, strings.Split(strings.ReplaceAll(*srv.Failover, " ", ""), ",")...)
+	}
+	return link
+}
+
 func coalesceString(left *string, right *string) *string {
 	if left != nil {
 		return left
@@ -149,12 +343,32 @@ func coalesceInt(left *int, right *int) *int {
 	return right
 }
 
-func makeConn(typ *string, host *string, fovr *string, port *int, db *string, user *string, pass *string) (conn string, err error) {
+func makeConn(srv model.DBServer) (conn string, err error) {
+	typ, host, fovr, port, db, user := srv.Type, srv.Host, srv.Failover, srv.Port, srv.DB, srv.User
 	if typ == nil {
 		return conn, fmt.Errorf("empty type")
 	}
-	if host == nil || *host == "" || db == nil || *db == "" || user == nil || *user == "" || pass == nil || *pass == "" {
-		return "", fmt.Errorf("host, db, user, password are required")
+	switch *typ {
+	case "http":
+		// base URL, may be empty if Origin is an absolute URL
+		if host != nil {
+			conn = strings.TrimRight(*host, "/")
+		}
+		return
+	case "sqlite":
+		// DB is a file path
+		if db == nil || *db == "" {
+			return "", fmt.Errorf("db is required")
+		}
+		conn = *db + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+		return
+	}
+	pass, err := password(srv)
+	if err != nil {
+		return "", err
+	}
+	if host == nil || *host == "" || db == nil || *db == "" || user == nil || *user == "" || pass == "" {
+		return "", fmt.Errorf("host, db, user, password (or PasswordFile) are required")
 	}
 	switch *typ {
 	case "mssql":
@@ -166,17 +380,48 @@ func makeConn(typ *string, host *string, fovr *string, port *int, db *string, us
 		if port != nil && *port > 0 {
 			iport = *port
 		}
-		conn = fmt.Sprintf("server=%s; %sdatabase=%s; port=%d; user id=%s; password=%s",
-			*host, sfovr, *db, iport, *user, *pass)
+		tls, err := mssqlTLS(srv)
+		if err != nil {
+			return "", err
+		}
+		// ODBC format allows any characters in braced values
+		conn = fmt.Sprintf("odbc:server=%s; %sdatabase=%s; port=%d; user id=%s; password=%s%s",
+			*host, sfovr, *db, iport, *user, odbcValue(pass), tls)
 	case "postgres":
 		iport := 5432
 		if port != nil && *port != 0 {
 			iport = *port
 		}
-		conn = fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=disable",
-			*host, iport, *db, *user, *pass)
+		hosts, tsa := *host, ""
+		if fovr != nil && *fovr != "" {
+			// lib/pq tries hosts in order and keeps the one accepting writes
+			hosts += "," + strings.ReplaceAll(*fovr, " ", "")
+			tsa = " target_session_attrs=read-write"
+		}
+		tls, err := postgresTLS(srv)
+		if err != nil {
+			return "", err
+		}
+		conn = fmt.Sprintf("host=%s port=%d dbname=%s user=%s%s%s%s",
+			hosts, iport, *db, *user, pqParam("password", &pass), tls, tsa)
+	case "mysql":
+		iport := 3306
+		if port != nil && *port != 0 {
+			iport = *port
+		}
+		tls, err := mysqlTLS(srv)
+		if err != nil {
+			return "", err
+		}
+		conn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true&interpolateParams=true%s",
+			*user, pass, *host, iport, *db, tls)
 	default:
 		return "", fmt.Errorf("unsupported type: %s", *typ)
 	}
 	return
 }
+
+// odbcValue braces a value of ODBC connection string doubling closing braces
+func odbcValue(s string) string {
+	return "{" + strings.ReplaceAll(s, "}", "}}") + "}"
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+func TestValidateShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		timeout *model.Duration
+		valid   bool
+	}{
+		{nil, true},
+		{&model.Duration{Duration: 10 * time.Second}, true},
+		{&model.Duration{}, false},
+		{&model.Duration{Duration: -time.Second}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateConfig(&model.Settings{ShutdownTimeout: tt.timeout})
+		if (err == nil) != tt.valid {
+			t.Errorf("ShutdownTimeout %v: err %v", tt.timeout, err)
+		}
+	}
+}
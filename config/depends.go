@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// checkDependencies verifies that DependsOn refers to known scheduled pairs and has no cycles
+func checkDependencies(pairs []*model.SyncPair) error {
+	byName := make(map[string]*model.SyncPair, len(pairs))
+	for _, pair := range pairs {
+		byName[pair.Name] = pair
+	}
+	for _, pair := range pairs {
+		for _, name := range pair.DependsOn {
+			parent, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("unknown pair in DependsOn of %s: %s", pair.Name, name)
+			}
+			if parent.Origin == nil {
+				return fmt.Errorf("DependsOn of %s refers to a pair without Origin: %s", pair.Name, name)
+			}
+		}
+	}
+
+	// depth-first search for a back edge
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(pairs))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			i := 0
+			for path[i] != name {
+				i++
+			}
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path[i:], " -> "), name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, parent := range byName[name].DependsOn {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, pair := range pairs {
+		if err := visit(pair.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
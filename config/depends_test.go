@@ -0,0 +1,40 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	origin := "proc"
+	pair := func(name string, parents ...string) *model.SyncPair {
+		return &model.SyncPair{Name: name, Origin: &origin, DependsOn: parents}
+	}
+	pushOnly := &model.SyncPair{Name: "push"}
+	tests := []struct {
+		name  string
+		pairs []*model.SyncPair
+		err   string
+	}{
+		{"none", []*model.SyncPair{pair("a"), pair("b")}, ""},
+		{"chain", []*model.SyncPair{pair("c", "b"), pair("b", "a"), pair("a")}, ""},
+		{"diamond", []*model.SyncPair{pair("a"), pair("b", "a"), pair("c", "a"), pair("d", "b", "c")}, ""},
+		{"self", []*model.SyncPair{pair("a", "a")}, "dependency cycle: a -> a"},
+		{"simple cycle", []*model.SyncPair{pair("a", "b"), pair("b", "a")}, "dependency cycle: a -> b -> a"},
+		{"cycle below root", []*model.SyncPair{pair("a", "b"), pair("b", "c"), pair("c", "b")},
+			"dependency cycle: b -> c -> b"},
+		{"unknown", []*model.SyncPair{pair("a", "x")}, "unknown pair in DependsOn of a: x"},
+		{"push-only parent", []*model.SyncPair{pushOnly, pair("a", "push")},
+			"DependsOn of a refers to a pair without Origin: push"},
+	}
+	for _, tt := range tests {
+		err := checkDependencies(tt.pairs)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+var envVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} with environment variable values escaped for a JSON string.
+// Undefined variables are an error.
+func expandEnv(data []byte) ([]byte, error) {
+	var missing []string
+	seen := make(map[string]bool)
+	result := envVar.ReplaceAllFunc(data, func(m []byte) []byte {
+		name := string(m[2 : len(m)-1])
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			if !seen[name] {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+			return m
+		}
+		js, _ := json.Marshal(val)
+		return js[1 : len(js)-1] // without quotes
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined environment variable(s): %s", strings.Join(missing, ", "))
+	}
+	return result, nil
+}
+
+// password returns Password or the contents of PasswordFile
+func password(srv model.DBServer) (string, error) {
+	if srv.PasswordFile == nil || *srv.PasswordFile == "" {
+		if srv.Password == nil {
+			return "", nil
+		}
+		return *srv.Password, nil
+	}
+	b, err := os.ReadFile(*srv.PasswordFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
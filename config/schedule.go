@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zones for hosts without zoneinfo
+
+	"github.com/bhmj/sqlsync/model"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	weekdays   = map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+	overlapPolicies = map[string]bool{"skip": true, "queue": true, "cancel": true}
+	windowRange     = regexp.MustCompile(`^(\d{1,2}):(\d{2})-(\d{1,2}):(\d{2})$`)
+)
+
+// parseSchedule validates run schedule of a pair: Period, Schedule or DependsOn, and Overlap policy
+func parseSchedule(pair *model.SyncPair) error {
+	if pair.Overlap != nil && !overlapPolicies[*pair.Overlap] {
+		return fmt.Errorf("invalid Overlap of %s: %s", pair.Name, *pair.Overlap)
+	}
+	if len(pair.DependsOn) > 0 {
+		if pair.Schedule != nil {
+			return fmt.Errorf("Schedule and DependsOn are mutually exclusive: %s", pair.Name)
+		}
+		return nil
+	}
+	sch := pair.Schedule
+	if sch == nil {
+		if pair.Period.Duration <= 0 {
+			return fmt.Errorf("Period or Schedule is required: %s", pair.Name)
+		}
+		return nil
+	}
+	var err error
+	sch.Location = time.Local
+	if sch.Timezone != "" {
+		sch.Location, err = time.LoadLocation(sch.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid Schedule.Timezone of %s: %w", pair.Name, err)
+		}
+	}
+	switch {
+	case sch.Cron != "":
+		sch.Spec, err = cronParser.Parse(sch.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid Schedule.Cron of %s: %w", pair.Name, err)
+		}
+	case pair.Period.Duration > 0:
+		sch.Spec = cron.Every(pair.Period.Duration)
+	default:
+		return fmt.Errorf("Schedule.Cron or Period is required: %s", pair.Name)
+	}
+	sch.Allowed, err = parseWindows(sch.Allow)
+	if err != nil {
+		return fmt.Errorf("invalid Schedule.Allow of %s: %w", pair.Name, err)
+	}
+	sch.Blocked, err = parseWindows(sch.Blackout)
+	if err != nil {
+		return fmt.Errorf("invalid Schedule.Blackout of %s: %w", pair.Name, err)
+	}
+	if sch.Next(time.Now()).IsZero() {
+		return fmt.Errorf("Schedule never runs: %s", pair.Name)
+	}
+	return nil
+}
+
+func parseWindows(list []string) ([]model.Window, error) {
+	windows := make([]model.Window, 0, len(list))
+	for _, s := range list {
+		w, err := parseWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseWindow parses "[days] [HH:MM-HH:MM]": "Mon-Fri 09:00-18:00", "22:00-06:00", "Sat,Sun"
+func parseWindow(s string) (w model.Window, err error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return w, fmt.Errorf("%q: expected \"[days] [HH:MM-HH:MM]\"", s)
+	}
+	days := "mon-sun"
+	span := ""
+	if windowRange.MatchString(fields[len(fields)-1]) {
+		span = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 1 {
+		days = fields[0]
+	}
+	if err = parseDays(strings.ToLower(days), &w.Days); err != nil {
+		return w, fmt.Errorf("%q: %w", s, err)
+	}
+	if span == "" {
+		return w, nil
+	}
+	tokens := windowRange.FindStringSubmatch(span)
+	var hm [4]int
+	for i := range hm {
+		hm[i], _ = strconv.Atoi(tokens[i+1])
+	}
+	if hm[0] > 24 || hm[1] > 59 || hm[2] > 24 || hm[3] > 59 {
+		return w, fmt.Errorf("%q: invalid time", s)
+	}
+	w.From = time.Duration(hm[0])*time.Hour + time.Duration(hm[1])*time.Minute
+	w.To = time.Duration(hm[2])*time.Hour + time.Duration(hm[3])*time.Minute
+	if w.From > 24*time.Hour || w.To > 24*time.Hour {
+		return w, fmt.Errorf("%q: invalid time", s)
+	}
+	if w.To == 24*time.Hour {
+		w.To = 0 // until midnight
+	}
+	return w, nil
+}
+
+// parseDays parses comma separated weekdays and ranges: "mon-fri,sun"
+func parseDays(s string, days *[7]bool) error {
+	for _, item := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return fmt.Errorf("invalid weekday: %s", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return fmt.Errorf("invalid weekday: %s", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
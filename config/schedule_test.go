@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+func TestParseWindow(t *testing.T) {
+	weekdays := [7]bool{false, true, true, true, true, true, false}
+	everyDay := [7]bool{true, true, true, true, true, true, true}
+	tests := []struct {
+		in   string
+		want model.Window
+		err  bool
+	}{
+		{in: "Mon-Fri 09:00-18:00", want: model.Window{Days: weekdays, From: 9 * time.Hour, To: 18 * time.Hour}},
+		{in: "22:00-06:00", want: model.Window{Days: everyDay, From: 22 * time.Hour, To: 6 * time.Hour}},
+		{in: "Sat,Sun", want: model.Window{Days: [7]bool{true, false, false, false, false, false, true}}},
+		{in: "Fri-Mon", want: model.Window{Days: [7]bool{true, true, false, false, false, true, true}}},
+		{in: "sat 22:30-24:00", want: model.Window{Days: [7]bool{6: true}, From: 22*time.Hour + 30*time.Minute}},
+		{in: "9:05-9:10", want: model.Window{Days: everyDay, From: 9*time.Hour + 5*time.Minute, To: 9*time.Hour + 10*time.Minute}},
+		{in: "", err: true},
+		{in: "Mon 09:00-18:00 extra", err: true},
+		{in: "Funday", err: true},
+		{in: "Mon-Xyz 09:00-10:00", err: true},
+		{in: "25:00-26:00", err: true},
+		{in: "09:60-10:00", err: true},
+		{in: "24:30-01:00", err: true},
+		{in: "9-18", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseWindow(%q) = %+v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseWindow(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseWindow(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
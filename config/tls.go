@@ -0,0 +1,175 @@
+package config
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bhmj/sqlsync/model"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+var sslModes = map[string]bool{"disable": true, "require": true, "verify-ca": true, "verify-full": true}
+
+// sslMode returns validated SSLMode, empty if not set
+func sslMode(srv model.DBServer) (string, error) {
+	if srv.SSLMode == nil || *srv.SSLMode == "" {
+		return "", nil
+	}
+	mode := strings.ToLower(*srv.SSLMode)
+	if !sslModes[mode] {
+		return "", fmt.Errorf("invalid SSLMode: %s", *srv.SSLMode)
+	}
+	if (srv.SSLCert == nil) != (srv.SSLKey == nil) {
+		return "", errors.New("SSLCert and SSLKey must be set together")
+	}
+	return mode, nil
+}
+
+// postgresTLS returns connection string parameters for lib/pq
+func postgresTLS(srv model.DBServer) (string, error) {
+	mode, err := sslMode(srv)
+	if err != nil {
+		return "", err
+	}
+	if mode == "" {
+		mode = "disable"
+	}
+	if mode != "disable" && srv.SSLServerName != nil && *srv.SSLServerName != "" {
+		// pq verifies Host, so a different server name needs a custom tls.Config
+		key, err := registerTLS(srv, mode, pq.RegisterTLSConfig)
+		if err != nil {
+			return "", err
+		}
+		return " sslmode=pqgo-" + key, nil
+	}
+	params := " sslmode=" + mode
+	if mode != "disable" {
+		params += pqParam("sslrootcert", srv.SSLRootCert) + pqParam("sslcert", srv.SSLCert) + pqParam("sslkey", srv.SSLKey)
+	}
+	return params, nil
+}
+
+// mssqlTLS returns connection string parameters for go-mssqldb.
+// Client certificates are not supported by the driver.
+func mssqlTLS(srv model.DBServer) (string, error) {
+	mode, err := sslMode(srv)
+	if err != nil {
+		return "", err
+	}
+	if srv.SSLCert != nil {
+		return "", errors.New("client certificates are not supported for mssql")
+	}
+	switch mode {
+	case "":
+		return "", nil
+	case "disable":
+		return "; encrypt=disable", nil
+	case "require":
+		return "; encrypt=true; TrustServerCertificate=true", nil
+	}
+	// verify-ca, verify-full: the driver always verifies host name
+	params := "; encrypt=true; TrustServerCertificate=false"
+	if srv.SSLRootCert != nil && *srv.SSLRootCert != "" {
+		params += "; certificate=" + *srv.SSLRootCert
+	}
+	if srv.SSLServerName != nil && *srv.SSLServerName != "" {
+		params += "; hostNameInCertificate=" + *srv.SSLServerName
+	}
+	return params, nil
+}
+
+// mysqlTLS returns "tls" DSN parameter for go-sql-driver/mysql
+func mysqlTLS(srv model.DBServer) (string, error) {
+	mode, err := sslMode(srv)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case mode == "" || mode == "disable":
+		return "", nil
+	case mode == "require" && srv.SSLCert == nil:
+		return "&tls=skip-verify", nil
+	}
+	key, err := registerTLS(srv, mode, mysql.RegisterTLSConfig)
+	if err != nil {
+		return "", err
+	}
+	return "&tls=" + key, nil
+}
+
+// registerTLS builds tls.Config for the server and registers it with a driver
+// under a key derived from TLS settings, so equal settings give equal connection strings
+func registerTLS(srv model.DBServer, mode string, register func(string, *tls.Config) error) (string, error) {
+	cfg, err := tlsConfig(srv, mode)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	for _, s := range []*string{srv.Host, srv.SSLRootCert, srv.SSLCert, srv.SSLKey, srv.SSLServerName, &mode} {
+		if s != nil {
+			h.Write([]byte(*s))
+		}
+		h.Write([]byte{0})
+	}
+	key := "sqlsync-" + hex.EncodeToString(h.Sum(nil))[:16]
+	return key, register(key, cfg)
+}
+
+// tlsConfig builds TLS client config: require encrypts without verification,
+// verify-ca verifies certificate chain, verify-full also verifies server name
+func tlsConfig(srv model.DBServer, mode string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if srv.SSLServerName != nil && *srv.SSLServerName != "" {
+		cfg.ServerName = *srv.SSLServerName
+	} else if srv.Host != nil {
+		cfg.ServerName = *srv.Host
+	}
+	if srv.SSLRootCert != nil && *srv.SSLRootCert != "" {
+		pem, err := os.ReadFile(*srv.SSLRootCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *srv.SSLRootCert)
+		}
+	}
+	if srv.SSLCert != nil {
+		cert, err := tls.LoadX509KeyPair(*srv.SSLCert, *srv.SSLKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	switch mode {
+	case "require":
+		cfg.InsecureSkipVerify = true
+	case "verify-ca":
+		cfg.InsecureSkipVerify = true
+		roots := cfg.RootCAs
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return cfg, nil
+}
+
+// pqParam returns quoted key='value' connection string parameter, empty if not set
+func pqParam(key string, val *string) string {
+	if val == nil || *val == "" {
+		return ""
+	}
+	return " " + key + "='" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(*val) + "'"
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// error stages
+const (
+	StageQuery = "query"
+	StageStore = "store"
+	StageRV    = "rv"
+)
+
+var (
+	rowsRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlsync_rows_read_total",
+		Help: "Rows read from Origin, by recordset.",
+	}, []string{"pair", "recordset"})
+
+	rowsWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlsync_rows_written_total",
+		Help: "Rows stored to Dest, by recordset.",
+	}, []string{"pair", "recordset"})
+
+	runDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sqlsync_run_duration_seconds",
+		Help:    "Duration of a sync run.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"pair"})
+
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlsync_errors_total",
+		Help: "Sync errors by stage (query, store, rv).",
+	}, []string{"pair", "stage"})
+
+	rowVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sqlsync_rv",
+		Help: "Current RV value of a pair parameter.",
+	}, []string{"pair", "param"})
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlsync_retries_total",
+		Help: "Retries after transient errors.",
+	}, []string{"pair"})
+
+	alerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlsync_alerts_total",
+		Help: "Runs failed with a permanent error or out of retries.",
+	}, []string{"pair"})
+
+	failovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlsync_failover_total",
+		Help: "Active host switches of a multi-host connection.",
+	}, []string{"hosts"})
+
+	activeHost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sqlsync_active_host",
+		Help: "1 for the active host of a multi-host connection.",
+	}, []string{"hosts", "host"})
+
+	missedTicks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlsync_missed_ticks_total",
+		Help: "Scheduled runs skipped because the previous run was still in progress.",
+	}, []string{"pair"})
+
+	lastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sqlsync_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful sync run.",
+	}, []string{"pair"})
+)
+
+func init() {
+	prometheus.MustRegister(rowsRead, rowsWritten, runDuration, errorsTotal, retries, alerts, failovers, activeHost,
+		rowVersion, lastSuccess, missedTicks)
+}
+
+// Handler returns HTTP handler exposing registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RowsRead adds rows read from a recordset
+func RowsRead(pair string, recordset int, n int) {
+	rowsRead.WithLabelValues(pair, strconv.Itoa(recordset)).Add(float64(n))
+}
+
+// RowsWritten adds rows stored to a recordset destination
+func RowsWritten(pair string, recordset int, n int) {
+	rowsWritten.WithLabelValues(pair, strconv.Itoa(recordset)).Add(float64(n))
+}
+
+// Error counts an error at a given stage
+func Error(pair string, stage string) {
+	errorsTotal.WithLabelValues(pair, stage).Inc()
+}
+
+// Retry counts a retry after transient error
+func Retry(pair string) {
+	retries.WithLabelValues(pair).Inc()
+}
+
+// Alert counts a run failed for good
+func Alert(pair string) {
+	alerts.WithLabelValues(pair).Inc()
+}
+
+// Failover counts an active host switch
+func Failover(hosts string) {
+	failovers.WithLabelValues(hosts).Inc()
+}
+
+// ActiveHost marks the active host of a multi-host connection
+func ActiveHost(hosts string, prev string, host string) {
+	if prev != "" {
+		activeHost.WithLabelValues(hosts, prev).Set(0)
+	}
+	activeHost.WithLabelValues(hosts, host).Set(1)
+}
+
+// MissedTick counts a scheduled run dropped by overlap policy
+func MissedTick(pair string) {
+	missedTicks.WithLabelValues(pair).Inc()
+}
+
+// RV sets current RV value
+func RV(pair string, param string, value int64) {
+	rowVersion.WithLabelValues(pair, param).Set(float64(value))
+}
+
+// Run records run duration and, if successful, the completion time
+func Run(pair string, start time.Time, err error) {
+	runDuration.WithLabelValues(pair).Observe(time.Since(start).Seconds())
+	if err == nil {
+		lastSuccess.WithLabelValues(pair).SetToCurrentTime()
+	}
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"sync"
@@ -14,13 +15,28 @@ type Duration struct {
 
 // DBServer stores server info
 type DBServer struct {
-	Type     *string // mssql, postgre, http
-	Host     *string
-	Failover *string
+	Type     *string // mssql, postgres, http
+	Host     *string // hostname (base URL for http)
+	Failover *string // failover partner (MS SQL), comma separated standby hosts (Postgres)
 	Port     *int
 	DB       *string
 	User     *string
 	Password *string
+	// file containing the password (e.g. a mounted secret), re-read on every new connection
+	PasswordFile *string
+	Headers      map[string]string // http: extra request headers
+	Timeout      *Duration         // http: request timeout including response body, 1m by default
+	// TLS
+	SSLMode       *string // disable (default), require, verify-ca, verify-full
+	SSLRootCert   *string // CA bundle (PEM file), system roots by default
+	SSLCert       *string // client certificate (PEM file), postgres and mysql only
+	SSLKey        *string // client certificate key (PEM file)
+	SSLServerName *string // name to verify server certificate against, Host by default
+	// connection pool
+	MaxOpenConns    *int      // max open connections, unlimited by default
+	MaxIdleConns    *int      // max idle connections, 2 by default
+	ConnMaxLifetime *Duration // max connection lifetime, unlimited by default
+	MaxConcurrency  *int      // max pairs running on this connection at once, unlimited by default
 }
 
 // SideOrigin ...
@@ -38,26 +54,63 @@ type ColumnParamValue struct {
 	Output bool
 }
 
+// BulkOptions ...
+type BulkOptions struct {
+	Staging   *string // staging table, temporary table like Dest table by default
+	BatchSize int     // rows per COPY statement
+}
+
+// RetryPolicy ...
+type RetryPolicy struct {
+	Attempts   int       // max attempts per run including the first one, 3 by default
+	Backoff    *Duration // delay before the first retry, doubled on every next one, 1s by default
+	MaxBackoff *Duration // max delay between retries, 1m by default
+}
+
 // SyncPair represents a single job
 type SyncPair struct {
 	sync.Mutex
+	Name   string   // pair name for push endpoint, Origin by default
 	Source DBServer // optional
 	Target DBServer // optional
 	//
-	Origin      *string            // source proc
-	Dest        []*string          // destination proc
+	Origin      *string            // source proc (URL template for http, "table:name" for table)
+	Dest        []*string          // destination proc ("table:name" for table)
+	Key         []string           // primary key columns of Dest tables
+	Method      *string            // http: request method, GET by default
+	Body        *string            // http: request body template
+	Select      *string            // http: jsonpath to rows in response, whole response by default
 	ColumnParam []ColumnParamValue // params for origin proc ("column => param (value)")
 	Mapping     map[string]string  // origin -> dest field mapping (field -> field)
 	RowProc     []SideOrigin       // proc to call for every row (on condition)
+	Bulk        *BulkOptions       // bulk load through staging table (optional)
+	BatchSize   int                // rows per stored chunk, whole recordset by default
+	Retry       *RetryPolicy       // retry on transient errors (optional)
 	//
 	SourceLink *DBConnection
 	TargetLink *DBConnection
 	//
-	Period Duration
+	Period   Duration
+	Schedule *Schedule // cron expression and time windows (optional)
+	Overlap  *string   // when previous run is still in progress: skip (default), queue, cancel
+	//
+	DependsOn []string // pairs which must succeed before this one runs, instead of Period/Schedule
 	//
-	SyncTable     *string  // RV table name & location. Default is dst.sync.sqlsync (tbl varchar, param varchar, val bigint)
-	SyncTableSide string   // runtime: src or dst
-	TableType     []string // runtime: table type
+	SyncTable     *string    // RV table name & location. Default is dst.sync.sqlsync (tbl varchar, param varchar, val bigint)
+	SyncTableSide string     // runtime: src or dst
+	TableType     []string   // runtime: table type
+	OriginTable   bool       // runtime: Origin is a table
+	DestTable     []bool     // runtime: Dest is a table
+	Status        PairStatus // runtime: last run status
+	Retired       bool       // runtime: replaced or removed by reload
+}
+
+// PairStatus holds results of the last completed run
+type PairStatus struct {
+	sync.RWMutex
+	LastRun     time.Time // last completed run
+	LastSuccess time.Time // last successful run
+	LastError   string    // error of the last run, empty if succeeded
 }
 
 // Settings holds all the parameters for the syncer
@@ -65,15 +118,32 @@ type Settings struct {
 	sync.RWMutex
 	Source DBServer // common
 	Target DBServer // common
-	Sync   []SyncPair
+	Sync   []*SyncPair
+	Listen *string // embedded HTTP server address (optional)
+	// liveness: every pair must complete a run within LivenessPeriods x Period, 3 by default
+	LivenessPeriods *int
+	// max pairs running at once, unlimited by default
+	MaxConcurrency *int
+	// graceful shutdown: max time to wait for running syncs, 30s by default
+	ShutdownTimeout *Duration
 	// aux
-	Link []DBConnection
+	Link []*DBConnection
 }
 
-// DBConnection ...
+// DBConnection is a connection pool shared by pairs with the same connection string
 type DBConnection struct {
 	ConnString string
-	//DB         *sql.DB
+	Type       string
+	// pool settings
+	MaxOpen     int
+	MaxIdle     int
+	MaxLifetime time.Duration
+	MaxRuns     int      // max concurrent runs, 0 for unlimited
+	Hosts       []string // postgres: primary and failover hosts
+	// DSN rebuilds ConnString with current secrets, nil if ConnString is static
+	DSN func() (string, error)
+	//
+	DB *sql.DB // runtime
 }
 
 // MarshalJSON ...
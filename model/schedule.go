@@ -0,0 +1,88 @@
+package model
+
+import (
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	maxSkips   = 1000        // max activations skipped by windows in a row
+	windowScan = 8*24*60 + 1 // minutes to look for an open window (a week and a day)
+)
+
+// Schedule defines when a pair runs. Period is used if Cron is empty.
+type Schedule struct {
+	Cron     string   // cron expression: "0 2 * * *", "*/30 * * * * *" (with seconds), "@hourly", "@every 10m"
+	Timezone string   // IANA time zone for Cron and windows, local by default
+	Allow    []string // windows when runs may start ("Mon-Fri 09:00-18:00", "22:00-06:00", "Sat,Sun"), any time by default
+	Blackout []string // windows when runs must not start, same format
+	//
+	Spec     cron.Schedule  // runtime: parsed Cron
+	Location *time.Location // runtime: parsed Timezone
+	Allowed  []Window       // runtime: parsed Allow
+	Blocked  []Window       // runtime: parsed Blackout
+}
+
+// Window is a daily time range on given weekdays
+type Window struct {
+	Days [7]bool       // by time.Weekday
+	From time.Duration // since midnight
+	To   time.Duration // since midnight, less than From if the range spans midnight
+}
+
+// Contains reports whether t falls into the window. A range spanning midnight
+// belongs to the day it starts.
+func (w Window) Contains(t time.Time) bool {
+	day := t.Weekday()
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	switch {
+	case w.From < w.To:
+		return w.Days[day] && since >= w.From && since < w.To
+	case w.From == w.To: // whole day
+		return w.Days[day]
+	}
+	return w.Days[day] && since >= w.From || w.Days[(day+6)%7] && since < w.To
+}
+
+// Open reports whether a run may start at t
+func (s *Schedule) Open(t time.Time) bool {
+	t = t.In(s.Location)
+	for _, w := range s.Blocked {
+		if w.Contains(t) {
+			return false
+		}
+	}
+	if len(s.Allowed) == 0 {
+		return true
+	}
+	for _, w := range s.Allowed {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the first activation after t which is not excluded by windows,
+// zero time if there is none
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.Location)
+	for i := 0; i < maxSkips; i++ {
+		t = s.Spec.Next(t)
+		if t.IsZero() || s.Open(t) {
+			return t
+		}
+		// jump to the next open minute
+		open := t.Truncate(time.Minute)
+		for j := 0; j < windowScan && !s.Open(open); j++ {
+			open = open.Add(time.Minute)
+		}
+		if !s.Open(open) {
+			return time.Time{}
+		}
+		t = open.Add(-time.Nanosecond)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 2026-10-16 is Friday
+func at(loc *time.Location, day, hour, min int) time.Time {
+	return time.Date(2026, 10, day, hour, min, 0, 0, loc)
+}
+
+func TestWindowContains(t *testing.T) {
+	weekdays := Window{Days: [7]bool{1: true, 2: true, 3: true, 4: true, 5: true}, From: 9 * time.Hour, To: 18 * time.Hour}
+	saturdayNight := Window{Days: [7]bool{6: true}, From: 22 * time.Hour, To: 2 * time.Hour}
+	weekend := Window{Days: [7]bool{0: true, 6: true}}
+	tests := []struct {
+		name string
+		w    Window
+		t    time.Time
+		want bool
+	}{
+		{"weekday start", weekdays, at(time.UTC, 16, 9, 0), true},
+		{"weekday end", weekdays, at(time.UTC, 16, 18, 0), false},
+		{"weekday before", weekdays, at(time.UTC, 16, 8, 59), false},
+		{"weekday on saturday", weekdays, at(time.UTC, 17, 10, 0), false},
+		{"past midnight start", saturdayNight, at(time.UTC, 17, 22, 0), true},
+		{"past midnight next day", saturdayNight, at(time.UTC, 18, 1, 59), true},
+		{"past midnight end", saturdayNight, at(time.UTC, 18, 2, 0), false},
+		{"past midnight other day", saturdayNight, at(time.UTC, 18, 23, 0), false},
+		{"past midnight day before", saturdayNight, at(time.UTC, 17, 1, 0), false},
+		{"whole day", weekend, at(time.UTC, 18, 23, 59), true},
+		{"whole day next", weekend, at(time.UTC, 19, 0, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.w.Contains(tt.t); got != tt.want {
+			t.Errorf("%s: Contains(%s) = %v, want %v", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	halfHourly, _ := cron.ParseStandard("*/30 * * * *")
+	nightly, _ := cron.ParseStandard("0 2 * * *")
+	office := Window{Days: [7]bool{1: true, 2: true, 3: true, 4: true, 5: true}, From: 9 * time.Hour, To: 18 * time.Hour}
+	saturdayNight := Window{Days: [7]bool{6: true}, From: 22 * time.Hour, To: 2 * time.Hour}
+	lunch := Window{Days: [7]bool{true, true, true, true, true, true, true}, From: 12 * time.Hour, To: 13 * time.Hour}
+	windowed := &Schedule{Spec: halfHourly, Location: berlin,
+		Allowed: []Window{office, saturdayNight}, Blocked: []Window{lunch}}
+
+	tests := []struct {
+		name string
+		s    *Schedule
+		from time.Time
+		want time.Time
+	}{
+		{"open", windowed, at(berlin, 16, 10, 10), at(berlin, 16, 10, 30)},
+		{"blackout jump-ahead", windowed, at(berlin, 16, 11, 45), at(berlin, 16, 13, 0)},
+		{"inside blackout", windowed, at(berlin, 16, 12, 10), at(berlin, 16, 13, 0)},
+		{"next weekday window", windowed, at(berlin, 16, 17, 30), at(berlin, 17, 22, 0)},
+		{"past midnight", windowed, at(berlin, 17, 23, 30), at(berlin, 18, 0, 0)},
+		{"after past midnight window", windowed, at(berlin, 18, 1, 30), at(berlin, 19, 9, 0)},
+		{"other time zone", windowed, at(time.UTC, 16, 15, 30), at(berlin, 17, 22, 0)},
+		{"no windows", &Schedule{Spec: nightly, Location: berlin}, at(berlin, 16, 11, 45), at(berlin, 17, 2, 0)},
+		{"never", &Schedule{Spec: nightly, Location: berlin, Allowed: []Window{office}}, at(berlin, 16, 11, 45), time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%s) = %s, want %s", tt.name, tt.from, got, tt.want)
+		}
+	}
+}
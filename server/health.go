@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bhmj/sqlsync/model"
+	"github.com/bhmj/sqlsync/syncer"
+)
+
+const (
+	defaultLivenessPeriods = 3
+	minLiveness            = time.Minute // lower bound for short Periods
+	pingTimeout            = 5 * time.Second
+)
+
+type pairHealth struct {
+	Name        string     `json:"name"`
+	Alive       bool       `json:"alive"`
+	PushOnly    bool       `json:"push_only,omitempty"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+type pairReadiness struct {
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// handleHealth: GET /healthz
+// A pair is alive if it has completed a run (successful or not) within LivenessPeriods x Period
+// (or LivenessPeriods scheduled activations) since the last run or server start.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.settings.RLock()
+	defer s.settings.RUnlock()
+
+	periods := defaultLivenessPeriods
+	if s.settings.LivenessPeriods != nil {
+		periods = *s.settings.LivenessPeriods
+	}
+	byName := make(map[string]*model.SyncPair, len(s.settings.Sync))
+	for _, pair := range s.settings.Sync {
+		byName[pair.Name] = pair
+	}
+	alive := true
+	pairs := make([]pairHealth, 0, len(s.settings.Sync))
+	for _, pair := range s.settings.Sync {
+		ph := pairHealth{Name: pair.Name, Alive: true, PushOnly: pair.Origin == nil}
+		pair.Status.RLock()
+		if !pair.Status.LastRun.IsZero() {
+			t := pair.Status.LastRun
+			ph.LastRun = &t
+		}
+		if !pair.Status.LastSuccess.IsZero() {
+			t := pair.Status.LastSuccess
+			ph.LastSuccess = &t
+		}
+		ph.LastError = pair.Status.LastError
+		pair.Status.RUnlock()
+
+		if !ph.PushOnly {
+			since := s.started
+			if ph.LastRun != nil {
+				since = *ph.LastRun
+			}
+			ph.Alive = !time.Now().After(deadline(pair, since, periods, byName))
+		}
+		alive = alive && ph.Alive
+		pairs = append(pairs, ph)
+	}
+
+	status, code := "ok", http.StatusOK
+	if !alive {
+		status, code = "stalled", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "pairs": pairs})
+}
+
+// deadline returns the time by which a pair must complete its next run.
+// Dependent pairs are due by the latest deadline of their parents.
+func deadline(pair *model.SyncPair, since time.Time, periods int, byName map[string]*model.SyncPair) time.Time {
+	var limit time.Time
+	switch {
+	case len(pair.DependsOn) > 0:
+		for _, name := range pair.DependsOn {
+			if parent, ok := byName[name]; ok {
+				if t := deadline(parent, since, periods, byName); t.After(limit) {
+					limit = t
+				}
+			}
+		}
+	case pair.Schedule != nil:
+		limit = since
+		for i := 0; i < periods; i++ {
+			limit = pair.Schedule.Next(limit)
+		}
+	default:
+		limit = since.Add(time.Duration(periods) * pair.Period.Duration)
+	}
+	if floor := since.Add(minLiveness); limit.Before(floor) {
+		limit = floor
+	}
+	return limit
+}
+
+// handleReady: GET /readyz
+// Ready if every database link answers a ping.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	// do not hold settings lock while pinging
+	s.settings.RLock()
+	links := append([]*model.DBConnection(nil), s.settings.Link...)
+	type pairLinks struct {
+		name           string
+		source, target *model.DBConnection
+	}
+	pl := make([]pairLinks, 0, len(s.settings.Sync))
+	for _, pair := range s.settings.Sync {
+		p := pairLinks{name: pair.Name, target: pair.TargetLink}
+		if pair.Origin != nil {
+			p.source = pair.SourceLink
+		}
+		pl = append(pl, p)
+	}
+	s.settings.RUnlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+	linkErr := pingLinks(ctx, links)
+
+	ready := true
+	pairs := make([]pairReadiness, 0, len(pl))
+	for _, p := range pl {
+		pr := pairReadiness{Name: p.name, Ready: true}
+		if p.source != nil {
+			pr.Source = linkStatus(p.source, linkErr)
+			pr.Ready = pr.Source == "ok"
+		}
+		pr.Target = linkStatus(p.target, linkErr)
+		pr.Ready = pr.Ready && pr.Target == "ok"
+		ready = ready && pr.Ready
+		pairs = append(pairs, pr)
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "pairs": pairs})
+}
+
+// pingLinks pings all database links concurrently and returns errors by link.
+// HTTP links are not checked.
+func pingLinks(ctx context.Context, links []*model.DBConnection) map[*model.DBConnection]error {
+	result := make(map[*model.DBConnection]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, link := range links {
+		if link.Type == "http" {
+			continue
+		}
+		wg.Add(1)
+		go func(link *model.DBConnection) {
+			defer wg.Done()
+			var err error
+			if link.DB == nil {
+				err = syncer.ErrNotConnected
+			} else {
+				err = link.DB.PingContext(ctx)
+			}
+			mu.Lock()
+			result[link] = err
+			mu.Unlock()
+		}(link)
+	}
+	wg.Wait()
+	return result
+}
+
+func linkStatus(link *model.DBConnection, errs map[*model.DBConnection]error) string {
+	if link == nil {
+		return "ok"
+	}
+	if err := errs[link]; err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bhmj/sqlsync/metrics"
+	"github.com/bhmj/sqlsync/model"
+	"github.com/bhmj/sqlsync/syncer"
+)
+
+const maxPushBody = 64 << 20
+
+// Server is an embedded HTTP server
+type Server struct {
+	settings *model.Settings
+	http     *http.Server
+	log      *slog.Logger
+	started  time.Time
+}
+
+// New creates HTTP server listening on addr
+func New(addr string, settings *model.Settings, log *slog.Logger) *Server {
+	s := &Server{settings: settings, log: log, started: time.Now()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/push/", s.handlePush)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	s.http = &http.Server{Addr: addr, Handler: mux}
+	return s
+}
+
+// Run serves requests until ctx is done
+func (s *Server) Run(ctx context.Context) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.http.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return s.http.Shutdown(shutdownCtx)
+	}
+}
+
+// findPair returns top-level pair by name
+func (s *Server) findPair(name string) *model.SyncPair {
+	s.settings.RLock()
+	defer s.settings.RUnlock()
+	for _, pair := range s.settings.Sync {
+		if pair.Name == name {
+			return pair
+		}
+	}
+	return nil
+}
+
+// handlePush: POST /push/{pair name}
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/push/")
+	pair := s.findPair(name)
+	if pair == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown pair: " + name})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBody))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.settings.RLock() // pair config may be changed by reload
+	batch, err := syncer.PreparePush(pair, body, s.log)
+	s.settings.RUnlock()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	// a push waits for a running sync of the pair as long as the client does
+	applied, err := syncer.Push(r.Context(), pair, batch, s.log)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, syncer.ErrNotConnected) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, map[string]interface{}{"error": err.Error(), "applied": applied})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pair": name, "applied": applied})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
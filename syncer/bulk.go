@@ -0,0 +1,336 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bhmj/sqlsync/metrics"
+	"github.com/bhmj/sqlsync/model"
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+const (
+	defaultBulkBatch = 10000
+	tempStaging      = "sqlsync_staging"
+)
+
+// storeBulk loads rows into a staging table and then calls Dest procedure
+// or merges the staging table into Dest table, all in one transaction.
+// MS SQL procedures with a table type parameter receive rows in chunks instead.
+func storeBulk(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	tx, own, err := bulkTx(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if own {
+		defer tx.Rollback()
+	}
+
+	if bulkTVP(pair, recordset) {
+		err = storeTVP(ctx, tx, pair, recordset, heap)
+	} else {
+		err = loadBulk(ctx, tx, pair, recordset, heap)
+	}
+	if err != nil {
+		return err
+	}
+	if own {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// bulkTVP reports whether Dest is an MS SQL procedure receiving rows as table-valued parameter
+func bulkTVP(pair *model.SyncPair, recordset int) bool {
+	return *pair.Target.Type == "mssql" && pair.TableType[recordset] != "" && pair.Bulk.Staging == nil
+}
+
+// bulkTx returns current transaction or starts a new one
+func bulkTx(ctx context.Context, dst execer) (tx *sql.Tx, own bool, err error) {
+	switch db := dst.(type) {
+	case *sql.Tx:
+		return db, false, nil
+	case *sql.DB:
+		tx, err = db.BeginTx(ctx, nil)
+		return tx, true, err
+	}
+	return nil, false, errors.New("bulk load requires a database connection")
+}
+
+// loadBulk copies heap into a staging table and applies it to Dest
+func loadBulk(ctx context.Context, tx *sql.Tx, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	load, err := startBulk(ctx, tx, pair, recordset, heapColumns(heap))
+	if err != nil {
+		return err
+	}
+	for _, row := range heap {
+		err = load.add(ctx, row.(map[string]interface{}))
+		if err != nil {
+			return err
+		}
+	}
+	return load.finish(ctx)
+}
+
+// bulkLoad is a copy of rows into a staging table in progress. Rows are sent
+// in COPY / bulk copy statements of Bulk.BatchSize rows, so they need not be kept in memory.
+type bulkLoad struct {
+	tx      *sql.Tx
+	cols    []string
+	copyIn  string
+	batch   int
+	stmt    *sql.Stmt // statement in progress
+	pending int       // rows sent by stmt
+	rows    int       // rows sent in total
+	apply   string    // merges staging table into Dest or calls Dest procedure
+	cleanup string    // drops temporary staging table
+}
+
+// startBulk prepares a staging table for rows with the given columns
+func startBulk(ctx context.Context, tx *sql.Tx, pair *model.SyncPair, recordset int, cols []string) (*bulkLoad, error) {
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns to store in %s", *pair.Dest[recordset])
+	}
+	load := &bulkLoad{tx: tx, cols: cols, batch: bulkBatch(pair)}
+	var err error
+	switch *pair.Target.Type {
+	case "postgres":
+		err = load.postgresStaging(ctx, pair, recordset)
+	case "mssql":
+		err = load.mssqlStaging(ctx, pair, recordset)
+	default:
+		err = fmt.Errorf("bulk load is not supported for %s target", *pair.Target.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return load, nil
+}
+
+// postgresStaging prepares staging table for COPY FROM STDIN
+func (b *bulkLoad) postgresStaging(ctx context.Context, pair *model.SyncPair, recordset int) error {
+	const typ = "postgres"
+	staging := tempStaging
+	if pair.Bulk.Staging != nil {
+		staging = quoteName(typ, *pair.Bulk.Staging)
+		_, err := b.tx.ExecContext(ctx, "delete from "+staging)
+		if err != nil {
+			return err
+		}
+	} else {
+		// table Dest: temporary staging table of the same structure
+		_, err := b.tx.ExecContext(ctx, "drop table if exists pg_temp."+tempStaging)
+		if err != nil {
+			return err
+		}
+		_, err = b.tx.ExecContext(ctx, "create temp table "+tempStaging+" (like "+
+			quoteName(typ, *pair.Dest[recordset])+" including defaults) on commit drop")
+		if err != nil {
+			return err
+		}
+	}
+
+	quoted := make([]string, len(b.cols))
+	for i, col := range b.cols {
+		quoted[i] = quoteIdent(typ, col)
+	}
+	b.copyIn = "copy " + staging + " (" + strings.Join(quoted, ", ") + ") from stdin"
+	if pair.DestTable[recordset] {
+		b.apply = upsertQuery(typ, quoteName(typ, *pair.Dest[recordset]), b.cols, pair.Key,
+			"select "+strings.Join(quoted, ", ")+" from "+staging)
+	} else {
+		b.apply = "select * from " + quoteName(typ, *pair.Dest[recordset]) + "()"
+	}
+	return nil
+}
+
+// mssqlStaging prepares staging table for TDS bulk copy
+func (b *bulkLoad) mssqlStaging(ctx context.Context, pair *model.SyncPair, recordset int) error {
+	const typ = "mssql"
+	quoted := make([]string, len(b.cols))
+	for i, col := range b.cols {
+		quoted[i] = quoteIdent(typ, col)
+	}
+	dest := quoteName(typ, *pair.Dest[recordset])
+	names := b.cols
+	var staging string
+	if pair.Bulk.Staging != nil {
+		staging = quoteName(typ, *pair.Bulk.Staging)
+		_, err := b.tx.ExecContext(ctx, "DELETE FROM "+staging)
+		if err != nil {
+			return err
+		}
+		// bulk copy matches column names exactly
+		names, err = columnNames(ctx, b.tx, staging, b.cols)
+		if err != nil {
+			return err
+		}
+	} else {
+		// table Dest: temporary staging table of the same structure;
+		// UNION ALL drops identity property so the values are copied as is
+		staging = "#" + tempStaging
+		list := strings.Join(quoted, ", ")
+		_, err := b.tx.ExecContext(ctx, "IF OBJECT_ID('tempdb.."+staging+"') IS NOT NULL DROP TABLE "+staging+";\n"+
+			"SELECT TOP 0 "+list+" INTO "+staging+" FROM "+dest+" UNION ALL SELECT TOP 0 "+list+" FROM "+dest)
+		if err != nil {
+			return err
+		}
+		b.cleanup = "DROP TABLE " + staging
+	}
+
+	b.copyIn = mssql.CopyIn(staging, mssql.BulkOptions{KeepNulls: true, RowsPerBatch: b.batch}, names...)
+	if pair.DestTable[recordset] {
+		b.apply = upsertQuery(typ, dest, b.cols, pair.Key, "SELECT "+strings.Join(quoted, ", ")+" FROM "+staging)
+	} else {
+		b.apply = "EXEC " + dest
+	}
+	return nil
+}
+
+// add sends a row, completing the statement in progress every Bulk.BatchSize rows
+func (b *bulkLoad) add(ctx context.Context, row map[string]interface{}) error {
+	if b.stmt == nil {
+		stmt, err := b.tx.PrepareContext(ctx, b.copyIn)
+		if err != nil {
+			return err
+		}
+		b.stmt = stmt
+	}
+	vals := make([]interface{}, len(b.cols))
+	for i, col := range b.cols {
+		vals[i] = paramValue(row[col])
+	}
+	_, err := b.stmt.ExecContext(ctx, vals...)
+	if err != nil {
+		return err
+	}
+	b.pending++
+	b.rows++
+	if b.pending >= b.batch {
+		return b.flush(ctx)
+	}
+	return nil
+}
+
+// flush completes the statement in progress
+func (b *bulkLoad) flush(ctx context.Context) error {
+	if b.stmt == nil {
+		return nil
+	}
+	_, err := b.stmt.ExecContext(ctx)
+	closeErr := b.stmt.Close()
+	b.stmt, b.pending = nil, 0
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// finish completes copying and applies the staging table to Dest
+func (b *bulkLoad) finish(ctx context.Context) error {
+	err := b.flush(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := b.tx.QueryContext(ctx, b.apply)
+	if err != nil {
+		return err
+	}
+	err = drain(rows)
+	if err != nil || b.cleanup == "" {
+		return err
+	}
+	_, err = b.tx.ExecContext(ctx, b.cleanup)
+	return err
+}
+
+// columnNames returns actual table column names matching fields case-insensitively
+func columnNames(ctx context.Context, tx *sql.Tx, table string, cols []string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT TOP 0 * FROM "+table)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		for _, name := range actual {
+			if strings.EqualFold(name, col) {
+				names[i] = name
+				break
+			}
+		}
+		if names[i] == "" {
+			return nil, fmt.Errorf("column %s not found in %s", col, table)
+		}
+	}
+	return names, nil
+}
+
+func bulkBatch(pair *model.SyncPair) int {
+	if pair.Bulk != nil && pair.Bulk.BatchSize > 0 {
+		return pair.Bulk.BatchSize
+	}
+	return defaultBulkBatch
+}
+
+// streamBulk reports whether rows of a recordset are copied to the staging table
+// as they are read instead of being collected first
+func streamBulk(ctx context.Context, pair *model.SyncPair, recordset int) bool {
+	return pair.Bulk != nil && pair.BatchSize == 0 && len(pair.RowProc) == 0 && dryRunFrom(ctx) == nil &&
+		recordset < len(pair.Dest) && !bulkTVP(pair, recordset)
+}
+
+// beginBulk starts a streamed bulk load of a recordset in a new transaction
+func beginBulk(ctx context.Context, dst *sql.DB, pair *model.SyncPair, recordset int, cols []string) (*bulkLoad, error) {
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	load, err := startBulk(ctx, tx, pair, recordset, cols)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return load, nil
+}
+
+// storeStream completes a streamed bulk load and stores RVs the way storeBatch does:
+// in the same transaction if the sync table is on destination side, after commit otherwise
+func storeStream(ctx context.Context, src *sql.DB, pair *model.SyncPair, recordset int, load *bulkLoad, pv []model.ColumnParamValue, log *slog.Logger) error {
+	log.Debug("store", "dest", *pair.Dest[recordset], "rows", load.rows)
+	err := load.finish(ctx)
+	if err != nil {
+		metrics.Error(pair.Name, metrics.StageStore)
+		load.tx.Rollback()
+		return err
+	}
+	if pair.SyncTableSide != "src" {
+		err = storeRV(ctx, load.tx, pair, pv, log)
+		if err != nil {
+			metrics.Error(pair.Name, metrics.StageRV)
+			load.tx.Rollback()
+			return err
+		}
+	}
+	err = load.tx.Commit()
+	if err != nil {
+		metrics.Error(pair.Name, metrics.StageStore)
+		return err
+	}
+	metrics.RowsWritten(pair.Name, recordset, load.rows)
+	if pair.SyncTableSide == "src" {
+		err = storeRV(ctx, src, pair, pv, log)
+		if err != nil {
+			metrics.Error(pair.Name, metrics.StageRV)
+		}
+	}
+	return err
+}
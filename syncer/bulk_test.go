@@ -0,0 +1,150 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// logDriver is a database driver which records statements instead of running them
+type logDriver struct{ log *[]string }
+
+type logConn struct{ log *[]string }
+
+type logStmt struct {
+	log   *[]string
+	query string
+}
+
+type logRows struct{}
+
+func (d logDriver) Open(string) (driver.Conn, error) { return logConn(d), nil }
+
+func (c logConn) Prepare(query string) (driver.Stmt, error) {
+	*c.log = append(*c.log, "prepare "+query)
+	return logStmt{log: c.log, query: query}, nil
+}
+func (c logConn) Close() error              { return nil }
+func (c logConn) Begin() (driver.Tx, error) { return c, nil }
+func (c logConn) Commit() error             { *c.log = append(*c.log, "commit"); return nil }
+func (c logConn) Rollback() error           { *c.log = append(*c.log, "rollback"); return nil }
+
+func (s logStmt) Close() error  { return nil }
+func (s logStmt) NumInput() int { return -1 }
+func (s logStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.HasPrefix(s.query, "copy ") {
+		*s.log = append(*s.log, fmt.Sprintf("row %v", args))
+	} else {
+		*s.log = append(*s.log, "exec "+s.query)
+	}
+	return driver.RowsAffected(0), nil
+}
+func (s logStmt) Query(args []driver.Value) (driver.Rows, error) {
+	*s.log = append(*s.log, "query "+s.query)
+	return logRows{}, nil
+}
+
+func (logRows) Columns() []string              { return []string{"param", "value"} }
+func (logRows) Close() error                   { return nil }
+func (logRows) Next(dest []driver.Value) error { return io.EOF }
+
+func TestLoadBulk(t *testing.T) {
+	var log []string
+	sql.Register("sqlsync-log", logDriver{log: &log})
+	db, err := sql.Open("sqlsync-log", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := func(v string) *string { return &v }
+	pair := &model.SyncPair{Target: model.DBServer{Type: s("postgres")}, Dest: []*string{s("items")},
+		Key: []string{"id"}, DestTable: []bool{true}, Bulk: &model.BulkOptions{BatchSize: 2}}
+	heap := make([]interface{}, 0, 5)
+	for i := 1; i <= 5; i++ {
+		heap = append(heap, map[string]interface{}{"id": int64(i)})
+	}
+	ctx := context.Background()
+	err = storeBulk(ctx, db, pair, 0, heap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyIn := `prepare copy sqlsync_staging ("id") from stdin`
+	want := []string{
+		"prepare drop table if exists pg_temp.sqlsync_staging",
+		"exec drop table if exists pg_temp.sqlsync_staging",
+		`prepare create temp table sqlsync_staging (like "items" including defaults) on commit drop`,
+		`exec create temp table sqlsync_staging (like "items" including defaults) on commit drop`,
+		copyIn, "row [1]", "row [2]", "row []",
+		copyIn, "row [3]", "row [4]", "row []",
+		copyIn, "row [5]", "row []",
+		`prepare insert into "items" ("id") select "id" from sqlsync_staging on conflict ("id") do nothing`,
+		`query insert into "items" ("id") select "id" from sqlsync_staging on conflict ("id") do nothing`,
+		"commit",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("statements:\n%s\nwant:\n%s", strings.Join(log, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStreamBulk(t *testing.T) {
+	var log []string
+	sql.Register("sqlsync-log-stream", logDriver{log: &log})
+	dst, err := sql.Open("sqlsync-log-stream", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	src, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	src.SetMaxOpenConns(1)
+	_, err = src.Exec(`create table items (id integer primary key, rv integer);
+		insert into items values (1, 10), (2, 20), (3, 30)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := func(v string) *string { return &v }
+	pair := &model.SyncPair{Name: "items", Origin: s("items"), Dest: []*string{s("items")}, Key: []string{"id"},
+		Source: model.DBServer{Type: s("sqlite")}, Target: model.DBServer{Type: s("postgres")},
+		OriginTable: true, DestTable: []bool{true}, TableType: []string{""}, Bulk: &model.BulkOptions{BatchSize: 2},
+		SyncTable: s("sqlsync"), SyncTableSide: "dst",
+		ColumnParam: []model.ColumnParamValue{{Column: "rv", Param: "rv"}}}
+	if !streamBulk(context.Background(), pair, 0) {
+		t.Fatal("recordset is not streamed")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	err = doSync(context.Background(), src, dst, pair, 0, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.ColumnParam[0].Value != 30 {
+		t.Errorf("RV = %d, want 30", pair.ColumnParam[0].Value)
+	}
+	rows := 0
+	for _, line := range log {
+		if strings.HasPrefix(line, "row [") && line != "row []" {
+			rows++
+		}
+	}
+	if rows != 3 {
+		t.Errorf("%d rows copied, want 3", rows)
+	}
+	// RV is stored in the load transaction
+	n := len(log)
+	if n < 2 || log[n-1] != "commit" || !strings.HasPrefix(log[n-2], "exec insert into \"sqlsync\"") {
+		t.Errorf("statements:\n%s", strings.Join(log, "\n"))
+	}
+}
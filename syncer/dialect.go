@@ -0,0 +1,107 @@
+package syncer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// placeholder returns n-th (1-based) positional parameter placeholder
+func placeholder(typ string, n int) string {
+	switch typ {
+	case "postgres":
+		return "$" + strconv.Itoa(n)
+	case "mssql":
+		return "@p" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// placeholders returns comma separated placeholders from..from+count-1
+func placeholders(typ string, from int, count int) string {
+	phs := make([]string, count)
+	for i := 0; i < count; i++ {
+		phs[i] = placeholder(typ, from+i)
+	}
+	return strings.Join(phs, ", ")
+}
+
+// quoteName quotes (possibly qualified) object name.
+// Already quoted parts are kept as is. Unquoted Postgres parts are lowercased
+// the same way the server folds unquoted identifiers.
+func quoteName(typ string, name string) string {
+	parts := splitName(name)
+	for i, part := range parts {
+		if strings.HasPrefix(part, `"`) || strings.HasPrefix(part, "[") || strings.HasPrefix(part, "`") {
+			continue
+		}
+		parts[i] = quoteIdent(typ, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteIdent quotes a single identifier
+func quoteIdent(typ string, ident string) string {
+	switch typ {
+	case "mssql":
+		return "[" + strings.ReplaceAll(ident, "]", "]]") + "]"
+	case "mysql":
+		return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+	case "postgres":
+		ident = foldIdent(typ, ident)
+	}
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+// foldIdent returns unquoted identifier the way the server folds it
+func foldIdent(typ string, ident string) string {
+	if typ == "postgres" {
+		return strings.ToLower(ident)
+	}
+	return ident
+}
+
+// unquoteIdent removes quotes from identifier
+func unquoteIdent(ident string) string {
+	if len(ident) > 1 {
+		switch ident[0] {
+		case '"', '`':
+			return strings.ReplaceAll(ident[1:len(ident)-1], ident[:1]+ident[:1], ident[:1])
+		case '[':
+			return strings.ReplaceAll(ident[1:len(ident)-1], "]]", "]")
+		}
+	}
+	return ident
+}
+
+// splitName splits qualified name by dots outside of quotes
+func splitName(name string) []string {
+	parts := make([]string, 0, 2)
+	var closing rune
+	start := 0
+	for i, r := range name {
+		switch {
+		case closing != 0:
+			if r == closing {
+				closing = 0
+			}
+		case r == '"' || r == '`':
+			closing = r
+		case r == '[':
+			closing = ']'
+		case r == '.':
+			parts = append(parts, name[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, name[start:])
+}
+
+// syncType returns server type of the sync table side
+func syncType(pair *model.SyncPair) string {
+	if pair.SyncTableSide == "src" {
+		return *pair.Source.Type
+	}
+	return *pair.Target.Type
+}
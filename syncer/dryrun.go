@@ -0,0 +1,124 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+type dryRunKey struct{}
+
+// dryRun writes what a run would store instead of storing it
+type dryRun struct {
+	enc *json.Encoder
+}
+
+// statement is an SQL statement with its arguments
+type statement struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// dryData is what storeData would send to Dest. Rows are given instead of statements for bulk copy.
+type dryData struct {
+	Pair       string        `json:"pair"`
+	Recordset  int           `json:"recordset"`
+	Dest       string        `json:"dest"`
+	Statements []statement   `json:"statements,omitempty"`
+	Rows       []interface{} `json:"rows,omitempty"`
+}
+
+// dryRV is what storeRV would persist
+type dryRV struct {
+	Pair      string           `json:"pair"`
+	SyncTable string           `json:"sync_table"`
+	Tbl       string           `json:"tbl"`
+	RV        map[string]int64 `json:"rv"`
+}
+
+// DryRun runs a pair once writing payloads for Dest and new RVs to w instead of storing them.
+// Source is queried, stored RVs and target metadata are read; nothing is written to the target or the sync table.
+func DryRun(ctx context.Context, pair *model.SyncPair, w io.Writer, logger *slog.Logger) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	ctx = context.WithValue(ctx, dryRunKey{}, &dryRun{enc: enc})
+	// missing sync table is not an error here
+	initRV := func(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, level int, logger *slog.Logger) error {
+		if err := doInit(ctx, src, dst, pair, level, logger); err != nil {
+			return syncError{err}
+		}
+		return nil
+	}
+	if err := process(ctx, pair, initRV, logger); err != nil {
+		logger.Warn("RVs not loaded, using config values", "pair", pair.Name, "err", err)
+	}
+	return process(ctx, pair, doSync, logger)
+}
+
+func dryRunFrom(ctx context.Context) *dryRun {
+	dry, _ := ctx.Value(dryRunKey{}).(*dryRun)
+	return dry
+}
+
+// data writes Dest payload of a recordset
+func (d *dryRun) data(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	out := dryData{Pair: pair.Name, Recordset: recordset, Dest: *pair.Dest[recordset]}
+	rec := &recorder{}
+	var err error
+	switch {
+	case pair.Bulk != nil:
+		out.Rows = heap
+	case pair.DestTable[recordset]:
+		err = storeTable(ctx, rec, pair, recordset, heap)
+	case *pair.Target.Type == "postgres":
+		var query string
+		var js []byte
+		query, js, err = postgresCall(pair, recordset, heap)
+		rec.stmts = append(rec.stmts, statement{Query: query, Args: []interface{}{json.RawMessage(js)}})
+	case *pair.Target.Type == "sqlite":
+		err = storeSQLite(ctx, rec, pair, recordset, heap)
+	case *pair.Target.Type == "mssql" && pair.TableType[recordset] == "":
+		rec.stmts, err = namedBatches(pair, recordset, heap)
+	case *pair.Target.Type == "mssql":
+		rec.stmts, err = tvpBatches(ctx, dst, pair, recordset, heap)
+	case *pair.Target.Type == "mysql":
+		rec.stmts, err = mysqlCalls(ctx, dst, pair, recordset, heap)
+	default:
+		out.Rows = heap
+	}
+	if err != nil {
+		return err
+	}
+	out.Statements = rec.stmts
+	return d.enc.Encode(out)
+}
+
+// rv writes RVs to be stored
+func (d *dryRun) rv(pair *model.SyncPair, pv []model.ColumnParamValue) error {
+	out := dryRV{Pair: pair.Name, SyncTable: pair.SyncTableSide + "." + *pair.SyncTable, Tbl: *pair.Origin,
+		RV: make(map[string]int64, len(pv))}
+	for _, p := range pv {
+		out.RV[p.Param] = p.Value
+	}
+	return d.enc.Encode(out)
+}
+
+// recorder is an execer which collects statements instead of executing them
+type recorder struct {
+	stmts []statement
+}
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.stmts = append(r.stmts, statement{Query: query, Args: args})
+	return driver.RowsAffected(0), nil
+}
+
+func (r *recorder) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("query is not supported in dry run")
+}
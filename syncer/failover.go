@@ -0,0 +1,133 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhmj/sqlsync/metrics"
+	"github.com/bhmj/sqlsync/model"
+	"github.com/lib/pq"
+)
+
+type hostKey struct{}
+
+// failoverConnector connects to the first Postgres host accepting writes
+// (target_session_attrs=read-write) and reports active host switches
+type failoverConnector struct {
+	connector *pq.Connector
+	dsn       func() (string, error) // rebuilds connection string with current secrets, optional
+	name      string                 // host list
+	log       *slog.Logger
+	mu        sync.Mutex
+	active    string
+}
+
+// openFailover opens a pool over multi-host Postgres connection string
+func openFailover(link *model.DBConnection, log *slog.Logger) (*sql.DB, error) {
+	connector, err := pq.NewConnector(link.ConnString)
+	if err != nil {
+		return nil, err
+	}
+	connector.Dialer(hostDialer{})
+	return sql.OpenDB(&failoverConnector{
+		connector: connector,
+		dsn:       link.DSN,
+		name:      strings.Join(link.Hosts, ","),
+		log:       log,
+	}), nil
+}
+
+// Connect implements driver.Connector
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector := c.connector
+	if c.dsn != nil {
+		dsn, err := c.dsn()
+		if err != nil {
+			return nil, err
+		}
+		connector, err = pq.NewConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		connector.Dialer(hostDialer{})
+	}
+	addr := new(string)
+	conn, err := connector.Connect(context.WithValue(ctx, hostKey{}, addr))
+	if err != nil {
+		return nil, err
+	}
+	c.setActive(*addr)
+	return conn, nil
+}
+
+// Driver implements driver.Connector
+func (c *failoverConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+func (c *failoverConnector) setActive(addr string) {
+	c.mu.Lock()
+	prev := c.active
+	c.active = addr
+	c.mu.Unlock()
+	if addr == prev || addr == "" {
+		return
+	}
+	metrics.ActiveHost(c.name, prev, addr)
+	if prev == "" {
+		c.log.Info("postgres host connected", "hosts", c.name, "host", addr)
+		return
+	}
+	metrics.Failover(c.name)
+	c.log.Warn("postgres host switched", "hosts", c.name, "from", prev, "to", addr)
+}
+
+// hostDialer records the address of the last established connection.
+// pq dials hosts one by one, so the last one is the host that passed session checks.
+type hostDialer struct {
+	net.Dialer
+}
+
+func (d hostDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d hostDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+func (d hostDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx, network, address)
+	if err == nil {
+		if addr, ok := ctx.Value(hostKey{}).(*string); ok {
+			*addr = address
+		}
+	}
+	return conn, err
+}
+
+// isReadOnly reports a write attempt on a Postgres standby (e.g. a demoted primary)
+func isReadOnly(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.SQLState() == "25006"
+}
+
+// resetIdle closes idle connections of the pair's Postgres failover links,
+// so the next connection goes through host selection again
+func resetIdle(pair *model.SyncPair) {
+	for _, link := range []*model.DBConnection{pair.SourceLink, pair.TargetLink} {
+		if link != nil && link.DB != nil && len(link.Hosts) > 0 {
+			link.DB.SetMaxIdleConns(0)
+			link.DB.SetMaxIdleConns(link.MaxIdle)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhmj/jsonslice"
+	"github.com/bhmj/sqlsync/model"
+)
+
+const defaultHTTPTimeout = time.Minute
+
+var httpClient = &http.Client{}
+
+// httpError is a non-2xx response of http source
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+// rowSource is a subset of *sql.Rows used by the syncer
+type rowSource interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	NextResultSet() bool
+	Close() error
+}
+
+// fetchHTTP calls the http source and returns response rows.
+// The request including the response body is limited by Source.Timeout.
+func fetchHTTP(ctx context.Context, pair *model.SyncPair) (rowSource, error) {
+	timeout := defaultHTTPTimeout
+	if pair.Source.Timeout != nil && pair.Source.Timeout.Duration > 0 {
+		timeout = pair.Source.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := buildRequest(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if len(body) > 256 {
+			body = body[:256]
+		}
+		return nil, &httpError{
+			status: resp.StatusCode,
+			msg:    fmt.Sprintf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, body),
+		}
+	}
+	if pair.Select != nil && *pair.Select != "" {
+		body, err = jsonslice.Get(body, *pair.Select)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newJSONRows(body)
+}
+
+// buildRequest substitutes {param} placeholders in URL and body templates.
+// Params referenced in neither are added to the query string of a bodiless request.
+func buildRequest(ctx context.Context, pair *model.SyncPair) (*http.Request, error) {
+	method := http.MethodGet
+	if pair.Method != nil && *pair.Method != "" {
+		method = strings.ToUpper(*pair.Method)
+	}
+	link := *pair.Origin
+	if !strings.Contains(link, "://") {
+		link = pair.SourceLink.ConnString + "/" + strings.TrimLeft(link, "/")
+	}
+	body := ""
+	if pair.Body != nil {
+		body = *pair.Body
+	}
+	query := url.Values{}
+	for _, p := range pair.ColumnParam {
+		val := strconv.FormatInt(p.Value, 10)
+		tag := "{" + p.Param + "}"
+		inLink, inBody := strings.Contains(link, tag), strings.Contains(body, tag)
+		if inLink {
+			link = strings.ReplaceAll(link, tag, url.QueryEscape(val))
+		}
+		if inBody {
+			body = strings.ReplaceAll(body, tag, val)
+		}
+		if !inLink && !inBody && pair.Body == nil {
+			query.Set(p.Param, val)
+		}
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		q := u.Query()
+		for k, v := range query {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	var rdr io.Reader
+	if pair.Body != nil {
+		rdr = bytes.NewBufferString(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), rdr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if pair.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range pair.Source.Headers {
+		req.Header.Set(k, v)
+	}
+	if pair.Source.User != nil && *pair.Source.User != "" {
+		pass := ""
+		if pair.Source.Password != nil {
+			pass = *pair.Source.Password
+		}
+		req.SetBasicAuth(*pair.Source.User, pass)
+	}
+	return req, nil
+}
+
+// jsonRows iterates over JSON array of objects (single recordset)
+// or array of arrays of objects (multiple recordsets)
+type jsonRows struct {
+	sets [][]map[string]interface{}
+	set  int
+	row  int
+	cols []string
+}
+
+func newJSONRows(data []byte) (*jsonRows, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("JSON array expected")
+	}
+	rs := &jsonRows{row: -1}
+	nested := len(arr) > 0
+	for _, el := range arr {
+		if _, ok := el.([]interface{}); !ok {
+			nested = false
+			break
+		}
+	}
+	if !nested {
+		arr = []interface{}{arr}
+	}
+	for _, el := range arr {
+		set, err := jsonObjects(el.([]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		rs.sets = append(rs.sets, set)
+	}
+	return rs, nil
+}
+
+func jsonObjects(arr []interface{}) ([]map[string]interface{}, error) {
+	set := make([]map[string]interface{}, len(arr))
+	for i, el := range arr {
+		obj, ok := el.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("JSON object expected in array")
+		}
+		for k, v := range obj {
+			obj[k] = jsonValue(v)
+		}
+		set[i] = obj
+	}
+	return set, nil
+}
+
+func jsonValue(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		f, _ := n.Float64()
+		return f
+	}
+	return v
+}
+
+// Columns returns the sorted union of object keys in the current recordset
+func (r *jsonRows) Columns() ([]string, error) {
+	if r.cols == nil && r.set < len(r.sets) {
+		seen := make(map[string]bool)
+		r.cols = make([]string, 0)
+		for _, obj := range r.sets[r.set] {
+			for k := range obj {
+				if !seen[k] {
+					seen[k] = true
+					r.cols = append(r.cols, k)
+				}
+			}
+		}
+		sort.Strings(r.cols)
+	}
+	return r.cols, nil
+}
+
+func (r *jsonRows) Next() bool {
+	if r.set >= len(r.sets) {
+		return false
+	}
+	r.row++
+	return r.row < len(r.sets[r.set])
+}
+
+func (r *jsonRows) Scan(dest ...interface{}) error {
+	cols, _ := r.Columns()
+	if len(dest) != len(cols) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(cols), len(dest))
+	}
+	obj := r.sets[r.set][r.row]
+	for i, col := range cols {
+		d, ok := dest[i].(*interface{})
+		if !ok {
+			return fmt.Errorf("unsupported Scan destination %T", dest[i])
+		}
+		*d = obj[col]
+	}
+	return nil
+}
+
+func (r *jsonRows) Err() error { return nil }
+
+func (r *jsonRows) NextResultSet() bool {
+	r.set++
+	r.row = -1
+	r.cols = nil
+	return r.set < len(r.sets)
+}
+
+func (r *jsonRows) Close() error { return nil }
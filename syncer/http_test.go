@@ -0,0 +1,45 @@
+package syncer
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+func TestBuildRequest(t *testing.T) {
+	s := func(v string) *string { return &v }
+	tests := []struct {
+		name     string
+		origin   string
+		body     *string
+		wantURL  string
+		wantBody string
+	}{
+		{"url only", "http://api/items?since={rv}", nil, "http://api/items?since=42", ""},
+		{"query string", "http://api/items", nil, "http://api/items?rv=42", ""},
+		{"body only", "http://api/items", s(`{"since":{rv}}`), "http://api/items", `{"since":42}`},
+		{"url and body", "http://api/items/{rv}", s(`{"since":{rv}}`), "http://api/items/42", `{"since":42}`},
+	}
+	for _, tt := range tests {
+		pair := &model.SyncPair{Origin: &tt.origin, Body: tt.body,
+			ColumnParam: []model.ColumnParamValue{{Param: "rv", Value: 42}}}
+		req, err := buildRequest(context.Background(), pair)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := req.URL.String(); got != tt.wantURL {
+			t.Errorf("%s: URL = %s, want %s", tt.name, got, tt.wantURL)
+		}
+		body := ""
+		if req.Body != nil {
+			b, _ := io.ReadAll(req.Body)
+			body = string(b)
+		}
+		if body != tt.wantBody {
+			t.Errorf("%s: body = %s, want %s", tt.name, body, tt.wantBody)
+		}
+	}
+}
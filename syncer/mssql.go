@@ -0,0 +1,320 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhmj/sqlsync/model"
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// SQL Server limits the number of parameters in a single request to 2100
+const mssqlMaxParams = 2000
+
+var (
+	tvpColumnsCache sync.Map // conn + type name -> []string
+	paramName       = regexp.MustCompile(`^\w+$`)
+)
+
+// storeTVP calls Dest procedure with rows as table-valued parameter,
+// the whole heap at once or in chunks of Bulk.BatchSize rows
+func storeTVP(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	typeName := pair.TableType[recordset]
+	cols, err := tvpColumns(ctx, dst, pair.TargetLink.ConnString, typeName)
+	if err != nil {
+		return err
+	}
+	batch := len(heap)
+	if pair.Bulk != nil {
+		batch = bulkBatch(pair)
+	}
+	query := "EXEC " + quoteName("mssql", *pair.Dest[recordset]) + " @p1"
+	for start := 0; start < len(heap); start += batch {
+		end := start + batch
+		if end > len(heap) {
+			end = len(heap)
+		}
+		value, err := tvpValue(heap[start:end], cols)
+		if err != nil {
+			return err
+		}
+		rows, err := dst.QueryContext(ctx, query, mssql.TVP{TypeName: typeName, Value: value})
+		if err != nil {
+			return err
+		}
+		err = drain(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tvpBatches builds T-SQL batches equivalent to storeTVP calls: rows are inserted into
+// a table variable of the table type which is then passed to Dest procedure
+func tvpBatches(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) ([]statement, error) {
+	typeName := pair.TableType[recordset]
+	cols, err := tvpColumns(ctx, dst, pair.TargetLink.ConnString, typeName)
+	if err != nil {
+		return nil, err
+	}
+	batch := len(heap)
+	if pair.Bulk != nil {
+		batch = bulkBatch(pair)
+	}
+	list := make([]string, len(cols))
+	for i, col := range cols {
+		list[i] = quoteIdent("mssql", col)
+	}
+	insert := "INSERT INTO @t (" + strings.Join(list, ", ") + ") VALUES "
+	exec := "EXEC " + quoteName("mssql", *pair.Dest[recordset]) + " @t;\n"
+	batches := make([]statement, 0, 1)
+	for start := 0; start < len(heap); start += batch {
+		end := start + batch
+		if end > len(heap) {
+			end = len(heap)
+		}
+		query := "DECLARE @t " + quoteName("mssql", typeName) + ";\n"
+		args := make([]interface{}, 0, (end-start)*len(cols))
+		// a VALUES list is limited to 1000 rows
+		for from := start; from < end; from += 1000 {
+			to := from + 1000
+			if to > end {
+				to = end
+			}
+			values := make([]string, 0, to-from)
+			for _, row := range heap[from:to] {
+				m := row.(map[string]interface{})
+				values = append(values, "("+placeholders("mssql", len(args)+1, len(cols))+")")
+				for _, col := range cols {
+					args = append(args, paramValue(fieldByNameFold(m, col)))
+				}
+			}
+			query += insert + strings.Join(values, ", ") + ";\n"
+		}
+		batches = append(batches, statement{Query: query + exec, Args: args})
+	}
+	return batches, nil
+}
+
+// storeNamed calls Dest procedure for every row passing fields as named parameters.
+// Calls are sent in batches limited by the number of parameters.
+func storeNamed(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	batches, err := namedBatches(pair, recordset, heap)
+	if err != nil {
+		return err
+	}
+	for _, b := range batches {
+		rows, err := dst.QueryContext(ctx, b.Query, b.Args...)
+		if err != nil {
+			return err
+		}
+		err = drain(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namedBatches builds T-SQL batches of Dest procedure calls, one call per row
+func namedBatches(pair *model.SyncPair, recordset int, heap []interface{}) ([]statement, error) {
+	dest := quoteName("mssql", *pair.Dest[recordset])
+	batches := make([]statement, 0, 1)
+	for start := 0; start < len(heap); {
+		query := ""
+		args := make([]interface{}, 0)
+		for ; start < len(heap); start++ {
+			m := heap[start].(map[string]interface{})
+			if len(args) > 0 && len(args)+len(m) > mssqlMaxParams {
+				break
+			}
+			fields := make([]string, 0, len(m))
+			for k := range m {
+				fields = append(fields, k)
+			}
+			sort.Strings(fields)
+			list := make([]string, len(fields))
+			for i, f := range fields {
+				if !paramName.MatchString(f) {
+					return nil, fmt.Errorf("invalid parameter name: %s", f)
+				}
+				args = append(args, paramValue(m[f]))
+				list[i] = "@" + f + "=" + placeholder("mssql", len(args))
+			}
+			query += "EXEC " + dest + " " + strings.Join(list, ", ") + ";\n"
+		}
+		batches = append(batches, statement{Query: query, Args: args})
+	}
+	return batches, nil
+}
+
+// tvpColumns returns column names of a table type in definition order
+func tvpColumns(ctx context.Context, q execer, conn string, typeName string) ([]string, error) {
+	key := conn + "\x00" + typeName
+	if cols, ok := tvpColumnsCache.Load(key); ok {
+		return cols.([]string), nil
+	}
+	query := "SELECT c.name FROM sys.table_types t JOIN sys.columns c ON c.object_id = t.type_table_object_id" +
+		" WHERE t.user_type_id = TYPE_ID(@p1) ORDER BY c.column_id"
+	rows, err := q.QueryContext(ctx, query, typeName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := make([]string, 0)
+	for rows.Next() {
+		var col string
+		err = rows.Scan(&col)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("table type not found: %s", typeName)
+	}
+	tvpColumnsCache.Store(key, cols)
+	return cols, nil
+}
+
+var (
+	int64Type   = reflect.TypeOf(int64(0))
+	float64Type = reflect.TypeOf(float64(0))
+	boolType    = reflect.TypeOf(false)
+	stringType  = reflect.TypeOf("")
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte{})
+)
+
+// tvpValue builds a slice of structs with fields matching table type columns.
+// Field types are inferred from row values, NULLs are passed as nil pointers.
+func tvpValue(heap []interface{}, cols []string) (interface{}, error) {
+	// table type columns are matched to row fields case-insensitively
+	names := make([]string, len(cols))
+	first := heap[0].(map[string]interface{})
+	for i, col := range cols {
+		names[i] = col
+		for k := range first {
+			if strings.EqualFold(k, col) {
+				names[i] = k
+				break
+			}
+		}
+	}
+	fields := make([]reflect.StructField, len(cols))
+	for i, name := range names {
+		fields[i] = reflect.StructField{Name: fmt.Sprintf("F%d", i), Type: tvpFieldType(heap, name)}
+	}
+	typ := reflect.StructOf(fields)
+	value := reflect.MakeSlice(reflect.SliceOf(typ), len(heap), len(heap))
+	for r := range heap {
+		m := heap[r].(map[string]interface{})
+		for i, name := range names {
+			v := m[name]
+			if v == nil {
+				continue
+			}
+			field := value.Index(r).Field(i)
+			if field.Type() == bytesType {
+				field.Set(reflect.ValueOf(v))
+				continue
+			}
+			elem, err := tvpConvert(field.Type().Elem(), v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err.Error())
+			}
+			ptr := reflect.New(field.Type().Elem())
+			ptr.Elem().Set(elem)
+			field.Set(ptr)
+		}
+	}
+	return value.Interface(), nil
+}
+
+// tvpFieldType returns the common type of column values
+func tvpFieldType(heap []interface{}, name string) reflect.Type {
+	var typ reflect.Type
+	for r := range heap {
+		v := heap[r].(map[string]interface{})[name]
+		if v == nil {
+			continue
+		}
+		var t reflect.Type
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			t = int64Type
+		case float32, float64:
+			t = float64Type
+		case bool:
+			t = boolType
+		case time.Time:
+			t = timeType
+		case []byte:
+			t = bytesType
+		default:
+			t = stringType
+		}
+		switch {
+		case typ == nil || typ == t:
+			typ = t
+		case (typ == int64Type && t == float64Type) || (typ == float64Type && t == int64Type):
+			typ = float64Type
+		default:
+			typ = stringType
+		}
+	}
+	if typ == nil {
+		typ = stringType
+	}
+	if typ == bytesType {
+		return typ
+	}
+	return reflect.PtrTo(typ)
+}
+
+// tvpConvert converts value to the field type
+func tvpConvert(typ reflect.Type, v interface{}) (reflect.Value, error) {
+	if typ == stringType {
+		switch val := v.(type) {
+		case string:
+			return reflect.ValueOf(val), nil
+		case []byte:
+			return reflect.ValueOf(string(val)), nil
+		case time.Time:
+			return reflect.ValueOf(val.Format(time.RFC3339Nano)), nil
+		}
+		js, err := json.Marshal(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(string(js)), nil
+	}
+	val := reflect.ValueOf(v)
+	if !val.Type().ConvertibleTo(typ) {
+		return reflect.Value{}, fmt.Errorf("cannot convert %T to %s", v, typ)
+	}
+	return val.Convert(typ), nil
+}
+
+// paramValue encodes composite values (e.g. nested JSON) to be passed as string parameters
+func paramValue(v interface{}) interface{} {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		js, err := json.Marshal(v)
+		if err == nil {
+			return string(js)
+		}
+	}
+	return v
+}
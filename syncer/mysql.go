@@ -0,0 +1,153 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// rows per multi-statement CALL batch
+const mysqlBatchRows = 500
+
+var mysqlParamsCache sync.Map // conn + proc name -> []mysqlParam
+
+type mysqlParam struct {
+	name string
+	typ  string
+}
+
+// storeMySQL calls Dest procedure either with the whole heap as a single JSON argument
+// (if the procedure has one JSON/text parameter not matching any field) or once per row
+// with fields passed by procedure parameter names.
+func storeMySQL(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	calls, err := mysqlCalls(ctx, dst, pair, recordset, heap)
+	if err != nil {
+		return err
+	}
+	for _, c := range calls {
+		rows, err := dst.QueryContext(ctx, c.Query, c.Args...)
+		if err != nil {
+			return err
+		}
+		err = drain(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mysqlCalls builds CALL statements of Dest procedure: a single one with JSON argument
+// or multi-statement batches of mysqlBatchRows calls
+func mysqlCalls(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) ([]statement, error) {
+	dest := *pair.Dest[recordset]
+	params, err := mysqlParams(ctx, dst, pair.TargetLink.ConnString, dest)
+	if err != nil {
+		return nil, err
+	}
+	proc := quoteName("mysql", dest)
+
+	if isJSONParam(params, heap) {
+		js, err := json.Marshal(heap)
+		if err != nil {
+			return nil, err
+		}
+		return []statement{{Query: "CALL " + proc + "(?)", Args: []interface{}{string(js)}}}, nil
+	}
+
+	// multi-row CALL
+	call := "CALL " + proc + "(" + placeholders("mysql", 1, len(params)) + ");\n"
+	calls := make([]statement, 0, (len(heap)+mysqlBatchRows-1)/mysqlBatchRows)
+	for start := 0; start < len(heap); start += mysqlBatchRows {
+		end := start + mysqlBatchRows
+		if end > len(heap) {
+			end = len(heap)
+		}
+		args := make([]interface{}, 0, (end-start)*len(params))
+		for _, row := range heap[start:end] {
+			m := row.(map[string]interface{})
+			for _, p := range params {
+				args = append(args, paramValue(fieldByNameFold(m, p.name)))
+			}
+		}
+		calls = append(calls, statement{Query: strings.Repeat(call, end-start), Args: args})
+	}
+	return calls, nil
+}
+
+// isJSONParam reports whether heap should be passed as a single JSON argument
+func isJSONParam(params []mysqlParam, heap []interface{}) bool {
+	if len(params) != 1 {
+		return false
+	}
+	switch params[0].typ {
+	case "json", "longtext", "mediumtext", "text":
+	default:
+		return false
+	}
+	m := heap[0].(map[string]interface{})
+	_, found := fieldByNameFoldOk(m, params[0].name)
+	return !found
+}
+
+// mysqlParams returns IN parameters of a stored procedure in definition order
+func mysqlParams(ctx context.Context, q execer, conn string, name string) ([]mysqlParam, error) {
+	key := conn + "\x00" + name
+	if params, ok := mysqlParamsCache.Load(key); ok {
+		return params.([]mysqlParam), nil
+	}
+	parts := splitName(name)
+	var schema interface{}
+	if len(parts) > 1 {
+		schema = unquoteIdent(parts[len(parts)-2])
+	}
+	query := "SELECT PARAMETER_NAME, DATA_TYPE FROM information_schema.PARAMETERS" +
+		" WHERE SPECIFIC_SCHEMA = COALESCE(?, DATABASE()) AND SPECIFIC_NAME = ?" +
+		" AND ROUTINE_TYPE = 'PROCEDURE' AND PARAMETER_MODE IN ('IN', 'INOUT')" +
+		" ORDER BY ORDINAL_POSITION"
+	rows, err := q.QueryContext(ctx, query, schema, unquoteIdent(parts[len(parts)-1]))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	params := make([]mysqlParam, 0)
+	for rows.Next() {
+		var pname, ptype sql.NullString
+		err = rows.Scan(&pname, &ptype)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, mysqlParam{name: pname.String, typ: strings.ToLower(ptype.String)})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("procedure not found or has no parameters: %s", name)
+	}
+	mysqlParamsCache.Store(key, params)
+	return params, nil
+}
+
+// fieldByNameFold returns row field matched case-insensitively, nil if not found
+func fieldByNameFold(m map[string]interface{}, name string) interface{} {
+	v, _ := fieldByNameFoldOk(m, name)
+	return v
+}
+
+func fieldByNameFoldOk(m map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
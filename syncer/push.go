@@ -0,0 +1,167 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bhmj/sqlsync/metrics"
+	"github.com/bhmj/sqlsync/model"
+)
+
+type pushOp struct {
+	name string
+	dest int // Dest index
+}
+
+// push operations in order of execution
+var pushOps = []pushOp{
+	{"rows", 0},
+	{"insert", 0},
+	{"update", 0},
+	{"delete", 1},
+}
+
+// ErrNotConnected is returned when the pair destination has no open connection
+var ErrNotConnected = errors.New("not connected")
+
+// PushBatch is a push request mapped to Dest rows, ready to be stored
+type PushBatch struct {
+	ops   []pushOp
+	heaps [][]interface{}
+}
+
+// PreparePush parses and maps rows received from upstream.
+// Body is either a JSON array of rows (stored via Dest[0]) or a diff object
+// {"insert": [...], "update": [...], "delete": [...]} where inserts and updates
+// are stored via Dest[0] and deletes via Dest[1].
+// Pair config must not be changed concurrently (settings read lock).
+func PreparePush(pair *model.SyncPair, body []byte, logger *slog.Logger) (*PushBatch, error) {
+	diff, err := parsePush(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(diff["delete"]) > 0 && len(pair.Dest) < 2 {
+		return nil, fmt.Errorf("no Dest procedure for deletes in %s", pair.Name)
+	}
+	batch := &PushBatch{}
+	for _, op := range pushOps {
+		set, ok := diff[op.name]
+		if !ok {
+			continue
+		}
+		rows := &jsonRows{sets: [][]map[string]interface{}{set}, row: -1}
+		mapper, err := NewMapper(rows, pair.Mapping, pair.ColumnParam)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op.name, err.Error())
+		}
+		if len(mapper.Missing) > 0 && len(set) > 0 {
+			logger.Warn("missing fields", "pair", pair.Name, "op", op.name, "fields", mapper.Missing)
+		}
+		heap := make([]interface{}, 0, len(set))
+		for rows.Next() {
+			err = rows.Scan(mapper.Vals...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", op.name, err.Error())
+			}
+			heap = append(heap, mapper.copyRow())
+		}
+		batch.ops = append(batch.ops, op)
+		batch.heaps = append(batch.heaps, heap)
+	}
+	return batch, nil
+}
+
+// Push stores prepared rows into pair destination. Waits for a run in progress
+// unless ctx is done first. Returns the number of rows applied per operation
+// ("rows" for a plain array).
+func Push(ctx context.Context, pair *model.SyncPair, batch *PushBatch, logger *slog.Logger) (map[string]int, error) {
+	applied := make(map[string]int)
+	if err := lockPair(ctx, pair); err != nil {
+		return applied, err
+	}
+	defer pair.Unlock()
+
+	dst := pair.TargetLink.DB
+	if dst == nil || pair.Retired {
+		return applied, ErrNotConnected
+	}
+
+	log := logger.With("pair", pair.Name)
+	for i, op := range batch.ops {
+		heap := batch.heaps[i]
+		applied[op.name] = 0
+		if len(heap) == 0 {
+			continue
+		}
+		err := storeData(ctx, dst, pair, op.dest, heap, pair.ColumnParam, log.With("op", op.name, "recordset", op.dest))
+		if err != nil {
+			metrics.Error(pair.Name, metrics.StageStore)
+			return applied, fmt.Errorf("%s: %s", op.name, err.Error())
+		}
+		metrics.RowsWritten(pair.Name, op.dest, len(heap))
+		applied[op.name] = len(heap)
+	}
+	log.Info("pushed", "applied", applied)
+	return applied, nil
+}
+
+// lockPair locks pair unless ctx is done first
+func lockPair(ctx context.Context, pair *model.SyncPair) error {
+	locked := make(chan struct{})
+	go func() {
+		pair.Lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			pair.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// parsePush returns rows by operation
+func parsePush(body []byte) (map[string][]map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	result := make(map[string][]map[string]interface{})
+	switch val := v.(type) {
+	case []interface{}:
+		set, err := jsonObjects(val)
+		if err != nil {
+			return nil, err
+		}
+		result["rows"] = set
+	case map[string]interface{}:
+		for k, el := range val {
+			known := false
+			for _, op := range pushOps {
+				known = known || op.name == k
+			}
+			arr, ok := el.([]interface{})
+			if !known || !ok {
+				return nil, fmt.Errorf("unexpected diff key: %s", k)
+			}
+			set, err := jsonObjects(arr)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = set
+		}
+	default:
+		return nil, errors.New("JSON array or diff object expected")
+	}
+	return result, nil
+}
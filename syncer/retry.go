@@ -0,0 +1,173 @@
+package syncer
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bhmj/sqlsync/metrics"
+	"github.com/bhmj/sqlsync/model"
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultBackoff       = time.Second
+	defaultMaxBackoff    = time.Minute
+)
+
+// transient MS SQL errors: deadlock victim, lock timeout, Azure SQL throttling and failover
+var mssqlTransient = map[int32]bool{
+	1205: true, 1222: true, 233: true, 10053: true, 10054: true, 10060: true,
+	40143: true, 40197: true, 40501: true, 40613: true, 49918: true, 49919: true, 49920: true,
+}
+
+// transient MySQL errors: deadlock, lock wait timeout, too many connections, server gone away
+var mysqlTransient = map[uint16]bool{
+	1213: true, 1205: true, 1040: true, 1053: true, 2006: true, 2013: true,
+}
+
+type slotsKey struct{}
+
+// Slots are concurrency slots held by a run. They are released while the run waits to retry.
+type Slots interface {
+	Release()
+	Acquire(ctx context.Context) error
+}
+
+// WithSlots returns ctx carrying concurrency slots of a run
+func WithSlots(ctx context.Context, slots Slots) context.Context {
+	return context.WithValue(ctx, slotsKey{}, slots)
+}
+
+// withRetry runs fn until it succeeds, fails with a permanent error or attempts are exhausted.
+// Failures that are not retried raise an alert. fn logs its own errors.
+func withRetry(ctx context.Context, pair *model.SyncPair, log *slog.Logger, fn func() error) error {
+	attempts, backoff, maxBackoff := retryPolicy(pair)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if isReadOnly(err) {
+			// even without retries the next run must not reuse the demoted primary
+			resetIdle(pair)
+		}
+		if !isTransient(err) {
+			metrics.Alert(pair.Name)
+			return err
+		}
+		if attempt >= attempts {
+			metrics.Alert(pair.Name)
+			if attempt > 1 {
+				log.Error("retries exhausted", "pair", pair.Name, "alert", true, "attempts", attempt, "err", err)
+			}
+			return err
+		}
+		delay := jitter(backoff, attempt, maxBackoff)
+		metrics.Retry(pair.Name)
+		log.Warn("transient error, retrying", "pair", pair.Name, "attempt", attempt, "delay", delay.String(), "err", err)
+		slots, _ := ctx.Value(slotsKey{}).(Slots)
+		if slots != nil {
+			slots.Release()
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		if slots != nil && slots.Acquire(ctx) != nil {
+			return err
+		}
+	}
+}
+
+// retryPolicy returns retry settings of a pair, a single attempt if Retry is not set
+func retryPolicy(pair *model.SyncPair) (attempts int, backoff, maxBackoff time.Duration) {
+	attempts, backoff, maxBackoff = defaultRetryAttempts, defaultBackoff, defaultMaxBackoff
+	if pair.Retry == nil {
+		return 1, backoff, maxBackoff
+	}
+	if pair.Retry.Attempts > 0 {
+		attempts = pair.Retry.Attempts
+	}
+	if pair.Retry.Backoff != nil {
+		backoff = pair.Retry.Backoff.Duration
+	}
+	if pair.Retry.MaxBackoff != nil {
+		maxBackoff = pair.Retry.MaxBackoff.Duration
+	}
+	return
+}
+
+// jitter returns exponential delay for the attempt, randomized in [d/2, d)
+func jitter(backoff time.Duration, attempt int, maxBackoff time.Duration) time.Duration {
+	d := backoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	if d < 2 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// isTransient reports whether err is worth retrying: deadlocks, serialization failures,
+// lock timeouts, throttling and connection failures. Anything else (missing procedure,
+// type mismatch, constraint violation) is permanent.
+func isTransient(err error) bool {
+	var msErr mssql.Error
+	if errors.As(err, &msErr) {
+		return mssqlTransient[msErr.Number]
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		state := pqErr.SQLState()
+		switch state {
+		case "53300", "55P03", "57P01", "57P02", "57P03": // too many connections, lock not available, shutdown
+			return true
+		case "25006": // read only transaction: primary has been demoted
+			return true
+		}
+		// connection exception, serialization failure / deadlock
+		return strings.HasPrefix(state, "08") || strings.HasPrefix(state, "40")
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return mysqlTransient[myErr.Number]
+	}
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		code := liteErr.Code() & 0xff // primary result code
+		return code == 5 || code == 6 // SQLITE_BUSY, SQLITE_LOCKED
+	}
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.status == http.StatusTooManyRequests || httpErr.status >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, mysql.ErrInvalidConn)
+}
@@ -0,0 +1,55 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/bhmj/sqlsync/model"
+	"github.com/lib/pq"
+)
+
+func TestReadOnlyResetsIdle(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	link := &model.DBConnection{Type: "postgres", Hosts: []string{"primary", "standby"}, MaxIdle: 2, DB: db}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	readOnly := &pq.Error{Code: "25006"}
+
+	tests := []struct {
+		name     string
+		retry    *model.RetryPolicy
+		attempts int
+	}{
+		{"single attempt", nil, 1},
+		{"retries", &model.RetryPolicy{Attempts: 2, Backoff: &model.Duration{}}, 2},
+	}
+	for _, tt := range tests {
+		if err := db.Ping(); err != nil {
+			t.Fatal(err)
+		}
+		if idle := db.Stats().Idle; idle != 1 {
+			t.Fatalf("%s: %d idle connections before run", tt.name, idle)
+		}
+		pair := &model.SyncPair{Name: "p", SourceLink: link, TargetLink: link, Retry: tt.retry}
+		attempts := 0
+		err := withRetry(context.Background(), pair, logger, func() error {
+			attempts++
+			return readOnly
+		})
+		if err != readOnly {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, attempts, tt.attempts)
+		}
+		if idle := db.Stats().Idle; idle != 0 {
+			t.Errorf("%s: %d idle connections after read-only error, want 0", tt.name, idle)
+		}
+	}
+}
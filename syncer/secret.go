@@ -0,0 +1,48 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// secretConnector rebuilds connection string for every new connection,
+// so rotated secret files are picked up on reconnect
+type secretConnector struct {
+	driver driver.Driver
+	dsn    func() (string, error)
+}
+
+// openSecret opens a pool over link with a dynamic connection string
+func openSecret(link *model.DBConnection) (*sql.DB, error) {
+	db, err := openDB(link.Type, link.ConnString) // driver lookup only, no connection is made
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+	return sql.OpenDB(&secretConnector{driver: drv, dsn: link.DSN}), nil
+}
+
+// Connect implements driver.Connector
+func (c *secretConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := c.dsn()
+	if err != nil {
+		return nil, err
+	}
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(dsn)
+}
+
+// Driver implements driver.Connector
+func (c *secretConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,56 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// sqliteQuery runs Origin statement with ColumnParam values as named parameters
+func sqliteQuery(pair *model.SyncPair) (query string, args []interface{}) {
+	for _, p := range pair.ColumnParam {
+		args = append(args, sql.Named(p.Param, p.Value))
+	}
+	return *pair.Origin, args
+}
+
+// storeSQLite runs Dest statement for every row with fields as named parameters
+func storeSQLite(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	for _, row := range heap {
+		m := row.(map[string]interface{})
+		args := make([]interface{}, 0, len(m))
+		for k, v := range m {
+			args = append(args, sql.Named(k, paramValue(v)))
+		}
+		_, err := dst.ExecContext(ctx, *pair.Dest[recordset], args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteInit creates RV table if it does not exist
+func sqliteInit(ctx context.Context, sync execer, table string) error {
+	_, err := sync.ExecContext(ctx, "create table if not exists "+quoteName("sqlite", table)+
+		" (tbl text not null, param text not null, value integer, primary key (tbl, param))")
+	return err
+}
+
+// heapColumns returns the sorted union of row fields
+func heapColumns(heap []interface{}) []string {
+	seen := make(map[string]bool)
+	cols := make([]string, 0)
+	for _, row := range heap {
+		for k := range row.(map[string]interface{}) {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
@@ -7,129 +7,257 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bhmj/jsonslice"
+	"github.com/bhmj/sqlsync/metrics"
 	"github.com/bhmj/sqlsync/model"
-	_ "github.com/denisenkom/go-mssqldb" // MS SQL driver
-	_ "github.com/lib/pq"                // Postgres driver
+	mssql "github.com/denisenkom/go-mssqldb" // MS SQL driver
+	_ "github.com/go-sql-driver/mysql"       // MySQL driver
+	_ "github.com/lib/pq"                    // Postgres driver
+	_ "modernc.org/sqlite"                   // SQLite driver
 )
 
-type processor func(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, level int, quiet bool) error
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type processor func(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, level int, logger *slog.Logger) error
+
+// syncError is an error already logged along with pair context
+type syncError struct {
+	error
+}
 
-func identPrintf(level int, format string, a ...interface{}) (str string) {
-	for i := 0; i < level*2; i++ {
-		str += fmt.Sprintf("  ")
+func (e syncError) Unwrap() error { return e.error }
+
+// rvAttr groups RV values by param name
+func rvAttr(pv []model.ColumnParamValue) slog.Attr {
+	attrs := make([]interface{}, 0, len(pv))
+	for _, p := range pv {
+		attrs = append(attrs, slog.Int64(p.Param, p.Value))
 	}
-	str += fmt.Sprintf(" - ")
-	str += fmt.Sprintf(format, a...)
-	return
+	return slog.Group("rv", attrs...)
 }
 
-// DoSync ...
-func DoSync(ctx context.Context, pair *model.SyncPair, quiet bool) {
+// DoSync runs a pair and returns the error of the run
+func DoSync(ctx context.Context, pair *model.SyncPair, logger *slog.Logger) error {
 	pair.Lock()
-	process(ctx, pair, doSync, quiet)
+	if ctx.Err() != nil { // shutting down
+		pair.Unlock()
+		return ctx.Err()
+	}
+	if pair.Retired { // replaced by reload
+		pair.Unlock()
+		return nil
+	}
+	start := time.Now()
+	err := withRetry(ctx, pair, logger, func() error {
+		return process(ctx, pair, doSync, logger)
+	})
+	metrics.Run(pair.Name, start, err)
+	setStatus(pair, err)
 	pair.Unlock()
+	return err
+}
+
+// setStatus records the result of a completed run
+func setStatus(pair *model.SyncPair, err error) {
+	pair.Status.Lock()
+	defer pair.Status.Unlock()
+	pair.Status.LastRun = time.Now()
+	if err != nil {
+		pair.Status.LastError = err.Error()
+		return
+	}
+	pair.Status.LastSuccess = pair.Status.LastRun
+	pair.Status.LastError = ""
 }
 
 // Init ...
-func Init(pair *model.SyncPair) {
-	process(context.Background(), pair, doInit, false)
+func Init(pair *model.SyncPair, logger *slog.Logger) {
+	process(context.Background(), pair, doInit, logger)
 }
 
-func process(ctx context.Context, pair *model.SyncPair, fn processor, quiet bool) error {
+func process(ctx context.Context, pair *model.SyncPair, fn processor, logger *slog.Logger) error {
 
-	srcType := *pair.Source.Type
-	dstType := *pair.Target.Type
-	if srcType == "mssql" {
-		srcType = "sqlserver"
+	var src *sql.DB
+	if *pair.Source.Type != "http" {
+		src = pair.SourceLink.DB
 	}
-	if dstType == "mssql" {
-		dstType = "sqlserver"
+	dst := pair.TargetLink.DB
+	if (src == nil && *pair.Source.Type != "http") || dst == nil {
+		err := errors.New("not connected")
+		logger.Error("sync failed", "pair", pair.Name, "err", err)
+		return err
 	}
 
-	src, err := sql.Open(srcType, pair.SourceLink.ConnString)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "\nerror in %s: %s\n", *pair.Origin, err.Error())
-		return err
+	err := fn(ctx, src, dst, pair, 0, logger)
+	var logged syncError
+	if err != nil && !errors.As(err, &logged) {
+		logger.Error("sync failed", "pair", pair.Name, "err", err)
 	}
-	defer src.Close()
+	return err
+}
 
-	dst, err := sql.Open(dstType, pair.TargetLink.ConnString)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "\nerror in %s: %s\n", *pair.Origin, err.Error())
-		return err
+// Connect opens connection pools for all links
+func Connect(links []*model.DBConnection, log *slog.Logger) error {
+	for _, link := range links {
+		if link.Type == "http" || link.DB != nil {
+			continue
+		}
+		var db *sql.DB
+		var err error
+		switch {
+		case len(link.Hosts) > 0:
+			db, err = openFailover(link, log)
+		case link.DSN != nil:
+			db, err = openSecret(link)
+		default:
+			db, err = openDB(link.Type, link.ConnString)
+		}
+		if err != nil {
+			return err
+		}
+		db.SetMaxOpenConns(link.MaxOpen)
+		db.SetMaxIdleConns(link.MaxIdle)
+		db.SetConnMaxLifetime(link.MaxLifetime)
+		link.DB = db
+	}
+	return nil
+}
+
+// Disconnect closes connection pools
+func Disconnect(links []*model.DBConnection) {
+	for _, link := range links {
+		if link.DB != nil {
+			link.DB.Close()
+			link.DB = nil
+		}
 	}
-	defer dst.Close()
+}
 
-	err = fn(ctx, src, dst, pair, 0, quiet)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "\n%s: %s\n", *pair.Origin, err.Error())
+func openDB(typ string, conn string) (*sql.DB, error) {
+	if typ == "mssql" {
+		typ = "sqlserver"
 	}
-	return err
+	return sql.Open(typ, conn)
 }
 
-func doSync(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, level int, quiet bool) (err error) {
-	//dstType := *pair.Target.Type
+func doSync(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, level int, logger *slog.Logger) (err error) {
+	log := logger.With("pair", pair.Name, "level", level)
+	// ctx cancellation stops the run at the next RV checkpoint,
+	// a batch in progress is completed along with its RVs;
+	// an HTTP fetch writes nothing and is cancelled right away
+	work := context.WithoutCancel(ctx)
 
-	query, qargs, outs := buildQuery(pair)
-	rows, err := src.QueryContext(ctx, query, qargs...)
+	pv := make([]model.ColumnParamValue, len(pair.ColumnParam))
+	copy(pv, pair.ColumnParam)
+	recordset := 0
+	defer func() {
+		var logged syncError
+		if errors.Is(err, context.Canceled) {
+			log.Info("sync interrupted", "recordset", recordset, rvAttr(pv))
+			err = syncError{err}
+		}
+		if err != nil && !errors.As(err, &logged) {
+			log.Error("sync failed", "recordset", recordset, rvAttr(pv), "err", err)
+			err = syncError{err}
+		}
+	}()
+
+	var rows rowSource
+	var outs []int64
+	if *pair.Source.Type == "http" {
+		rows, err = fetchHTTP(ctx, pair)
+	} else {
+		var query string
+		var qargs []interface{}
+		query, qargs, outs = buildQuery(pair)
+		log.Debug("query", "query", query, rvAttr(pv))
+		rows, err = src.QueryContext(work, query, qargs...)
+	}
 	if err != nil {
+		metrics.Error(pair.Name, metrics.StageQuery)
 		return
 	}
 	defer rows.Close()
 
-	pv := make([]model.ColumnParamValue, len(pair.ColumnParam))
-	copy(pv, pair.ColumnParam)
-
-	args := ""
-	for _, t := range pv {
-		if len(args) > 0 {
-			args += ", "
+	counts := make([]int, 0, 1)
+	total := 0
+	var load *bulkLoad // streamed bulk load of the current recordset
+	defer func() {
+		if load != nil {
+			load.tx.Rollback()
 		}
-		args += "@" + t.Param + "=" + strconv.FormatInt(t.Value, 10)
-	}
-	msg := "\n" + identPrintf(level, "%s %s  [0]: ", *pair.Origin, args)
-
-	recs := 0
-	recordset := 0
+	}()
 	for {
 		mapper, err := NewMapper(rows, pair.Mapping, pair.ColumnParam)
 		if err != nil {
-			fmt.Print(msg)
+			metrics.Error(pair.Name, metrics.StageQuery)
 			return err
 		}
+		if len(mapper.Missing) > 0 {
+			log.Warn("missing fields", "recordset", recordset, "fields", mapper.Missing)
+		}
+		rlog := log.With("recordset", recordset)
 
 		heap := make([]interface{}, 0)
 		nrows := 0
+		rowRV := make([]int64, len(pv))
+		stream := streamBulk(ctx, pair, recordset)
 
 		for rows.Next() {
 			err = rows.Scan(mapper.Vals...)
 			if err != nil {
-				fmt.Print(msg)
+				metrics.Error(pair.Name, metrics.StageQuery)
 				return err
 			}
 			nrows++
-			// update RVs
+			// RVs of the row
+			newRV := false
 			for i := range pv { // source col, RV
-				nv := mapper.int64ByName(pv[i].Column)
-				if nv > pv[i].Value {
-					pv[i].Value = nv
+				rowRV[i], err = mapper.int64ByName(rvColumn(pair, pv[i]))
+				if err != nil {
+					metrics.Error(pair.Name, metrics.StageQuery)
+					return err
+				}
+				newRV = newRV || rowRV[i] > pv[i].Value
+			}
+			// a full chunk is flushed before the first row of the next RV value,
+			// so rows sharing a value are never split by a checkpoint
+			if newRV && pair.BatchSize > 0 && len(heap) >= pair.BatchSize {
+				// flush chunk and advance RV so a restart resumes mid-recordset
+				err = storeBatch(work, src, dst, pair, recordset, heap, pv, rlog)
+				if err != nil {
+					return err
+				}
+				advanceRV(pair, pv)
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				heap = heap[:0]
+			}
+			// update RVs
+			for i := range pv {
+				if rowRV[i] > pv[i].Value {
+					pv[i].Value = rowRV[i]
 				}
 			}
 			// process data
 			if len(pair.RowProc) > 0 {
 				// process row
-				fmt.Print(msg)
-				msg = ""
-				err = storeData(ctx, src, dst, pair, recordset, []interface{}{mapper.getRow()}, pv)
+				err = storeData(work, dst, pair, recordset, []interface{}{mapper.copyRow()}, pv, rlog)
 				if err != nil {
+					metrics.Error(pair.Name, metrics.StageStore)
 					return err
 				}
+				metrics.RowsWritten(pair.Name, recordset, 1)
 				// call row proc(s)
 				for p := 0; p < len(pair.RowProc); p++ {
 					proc := &pair.RowProc[p]
@@ -151,19 +279,39 @@ func doSync(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair,
 						sp := &proc.Sync[i]
 						// set proc params
 						for ip := 0; ip < len(sp.ColumnParam); ip++ {
-							val := mapper.int64ByName(sp.ColumnParam[ip].Column)
+							val, err := mapper.int64ByName(sp.ColumnParam[ip].Column)
+							if err != nil {
+								return err
+							}
 							sp.ColumnParam[ip].Value = val // real deal
 						}
-						err := doSync(ctx, src, dst, sp, level+1, quiet) // nested
+						err := doSync(ctx, src, dst, sp, level+1, logger) // nested
 						if err != nil {
 							return err
 						}
 					}
 				}
-				// store RV
-				err = storeRV(ctx, src, dst, pair, pv)
+				// store RV (row, nested syncs and RV are not atomic)
+				err = storeRV(work, syncSide(src, dst, pair), pair, pv, rlog)
 				if err != nil {
-					fmt.Print(msg)
+					metrics.Error(pair.Name, metrics.StageRV)
+					return err
+				}
+				advanceRV(pair, pv)
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+			} else if stream {
+				// rows go to the staging table right away
+				row := mapper.copyRow().(map[string]interface{})
+				if load == nil {
+					load, err = beginBulk(work, dst, pair, recordset, heapColumns([]interface{}{row}))
+				}
+				if err == nil {
+					err = load.add(work, row)
+				}
+				if err != nil {
+					metrics.Error(pair.Name, metrics.StageStore)
 					return err
 				}
 			} else {
@@ -172,83 +320,70 @@ func doSync(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair,
 		} // for rows.Next()
 		err = rows.Err()
 		if err != nil {
-			fmt.Print(msg)
+			metrics.Error(pair.Name, metrics.StageQuery)
 			return err
 		}
+		metrics.RowsRead(pair.Name, recordset, nrows)
 		// output params
 		for i := 0; i < len(pv); i++ {
-			if pv[i].Output && pv[i].Value < outs[i] {
+			if pv[i].Output && i < len(outs) && pv[i].Value < outs[i] {
 				pv[i].Value = outs[i]
 			}
 		}
 
-		msg += fmt.Sprintf("%d", nrows)
-		if len(heap) > 0 {
-			recs++
-			err = storeData(ctx, src, dst, pair, recordset, heap, pv)
-			if err != nil {
-				return err
-			}
+		counts = append(counts, nrows)
+		total += nrows
+		if load != nil {
+			err = storeStream(work, src, pair, recordset, load, pv, rlog)
+			load = nil
+		} else {
+			err = storeBatch(work, src, dst, pair, recordset, heap, pv, rlog)
 		}
-
-		err = storeRV(ctx, src, dst, pair, pv)
 		if err != nil {
 			return err
 		}
+		advanceRV(pair, pv)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
 		if !rows.NextResultSet() {
 			break
 		}
 		recordset++
-		msg += fmt.Sprintf("  [%d]: ", recordset)
 	} // forever
 
-	copy(pair.ColumnParam, pv)
-	if recs > 0 && !quiet {
-		fmt.Print(msg)
+	lvl := slog.LevelDebug
+	if total > 0 {
+		lvl = slog.LevelInfo
 	}
+	log.Log(ctx, lvl, "synced", "rows", counts, rvAttr(pv))
 	return
 }
 
-func doInit(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, level int, quiet bool) error {
-	ph := "?"
-	if *pair.Target.Type == "postgres" {
-		ph = "$1"
-	}
-	var sync *sql.DB
-	if pair.SyncTableSide == "src" {
-		sync = src
-	} else {
-		sync = dst
-	}
-
-	query := "select * from " + *pair.SyncTable + " where tbl = " + ph
-	rows, err := sync.QueryContext(ctx, query, *pair.Origin)
-	if err != nil {
-		return err
+func doInit(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, level int, logger *slog.Logger) error {
+	typ := syncType(pair)
+	sync := syncSide(src, dst, pair)
+	if typ == "sqlite" && dryRunFrom(ctx) == nil {
+		err := sqliteInit(ctx, sync, *pair.SyncTable)
+		if err != nil {
+			return err
+		}
 	}
-	defer rows.Close()
-
-	mapper, err := NewMapper(rows, map[string]string{"param": "param", "value": "value"}, nil)
+	query := "select param, value from " + quoteName(typ, *pair.SyncTable) + " where tbl = " + placeholder(typ, 1)
+	saved, err := readRV(ctx, sync, query, *pair.Origin)
 	if err != nil {
 		return err
 	}
-
-	for rows.Next() {
-		err = rows.Scan(mapper.Vals...)
-		if err != nil {
-			return err
-		}
-		dbParam := mapper.stringByName("param")
-		// through config params
-		for p := 0; p < len(pair.ColumnParam); p++ {
-			if dbParam == pair.ColumnParam[p].Param {
-				val := mapper.int64ByName("value")
-				pair.ColumnParam[p].Value = val // real deal
-			}
+	// through config params
+	for p := 0; p < len(pair.ColumnParam); p++ {
+		if val, ok := saved[pair.ColumnParam[p].Param]; ok {
+			pair.ColumnParam[p].Value = val // real deal
 		}
+		metrics.RV(pair.Name, pair.ColumnParam[p].Param, pair.ColumnParam[p].Value)
 	}
-	return err
+	logger.Debug("RV loaded", "pair", pair.Name, rvAttr(pair.ColumnParam))
+	return nil
 }
 
 // Mapper ...
@@ -256,16 +391,31 @@ type Mapper struct {
 	Vals  []interface{}
 	Map   map[string]int
 	PVals []interface{}
+	Types []string // database type names of columns, if known
+	// Missing lists mapped fields not found in recordset
+	Missing []string
 }
 
 // NewMapper ...
-func NewMapper(rows *sql.Rows, mapping map[string]string, pv []model.ColumnParamValue) (*Mapper, error) {
+func NewMapper(rows rowSource, mapping map[string]string, pv []model.ColumnParamValue) (*Mapper, error) {
 	cols, err := rows.Columns()
 	if err != nil {
 		return nil, err
 	}
 	mapper := &Mapper{}
 	mapper.PVals = make([]interface{}, 0)
+	mapper.Types = make([]string, len(cols))
+	if ct, ok := rows.(interface {
+		ColumnTypes() ([]*sql.ColumnType, error)
+	}); ok {
+		types, err := ct.ColumnTypes()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(types) && i < len(cols); i++ {
+			mapper.Types[i] = strings.ToUpper(types[i].DatabaseTypeName())
+		}
+	}
 	mapper.Vals = make([]interface{}, len(cols))
 	for i := 0; i < len(cols); i++ {
 		mapper.Vals[i] = new(interface{})
@@ -280,7 +430,6 @@ func NewMapper(rows *sql.Rows, mapping map[string]string, pv []model.ColumnParam
 			mapper.Map[col] = c
 		}
 	}
-	var notFound []string
 	for colsField, dstField := range mapping {
 		if colsField[:1] == "@" {
 			found := -1
@@ -294,26 +443,15 @@ func NewMapper(rows *sql.Rows, mapping map[string]string, pv []model.ColumnParam
 				mapper.PVals = append(mapper.PVals, pv[found].Value)
 				mapper.Map[dstField] = -len(mapper.PVals)
 			} else {
-				notFound = append(notFound, colsField)
+				mapper.Missing = append(mapper.Missing, colsField)
 			}
 			continue
 		}
 		_, ok := mapper.Map[dstField]
 		if !ok {
-			notFound = append(notFound, colsField+"("+dstField+")")
+			mapper.Missing = append(mapper.Missing, colsField+"("+dstField+")")
 		}
 	}
-	if len(notFound) > 0 {
-		for i := 0; i < len(notFound); i++ {
-			if i == 0 {
-				fmt.Printf("\tMissing fields: ")
-			} else {
-				fmt.Printf(", ")
-			}
-			fmt.Printf("%s", notFound[i])
-		}
-		fmt.Println("")
-	}
 	return mapper, nil
 }
 
@@ -336,12 +474,33 @@ func (m *Mapper) copyRow() interface{} {
 			row[fld] = m.PVals[-idx-1]
 		} else {
 			pval := m.Vals[idx]
-			row[fld] = *pval.(*interface{})
+			row[fld] = normalize(*pval.(*interface{}), m.Types[idx])
 		}
 	}
 	return row
 }
 
+// normalize converts driver-specific textual values returned as []byte
+// (decimals, uuids, json etc.) to strings so they are passed to destination as is
+func normalize(v interface{}, typ string) interface{} {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	switch typ {
+	case "UNIQUEIDENTIFIER":
+		var u mssql.UniqueIdentifier
+		if u.Scan(b) == nil {
+			return u.String()
+		}
+	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY", "UUID", "JSON", "JSONB", "XML",
+		"CHAR", "VARCHAR", "TEXT", "NCHAR", "NVARCHAR", "NTEXT", "BPCHAR",
+		"TINYTEXT", "MEDIUMTEXT", "LONGTEXT", "ENUM", "SET":
+		return string(b)
+	}
+	return v
+}
+
 func (m *Mapper) fieldByName(name string) interface{} {
 	i, ok := m.Map[name]
 	if !ok {
@@ -361,24 +520,45 @@ func (m *Mapper) stringByName(name string) string {
 	switch v.(type) {
 	case string:
 		return v.(string)
+	case []byte: // MySQL returns text columns as bytes
+		return string(v.([]byte))
 	}
 	return ""
 }
 
-func (m *Mapper) int64ByName(name string) int64 {
+// binaryTypes are column types whose 8-byte values are big-endian integers (MS SQL rowversion)
+var binaryTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true, "IMAGE": true, "BYTEA": true,
+	"BLOB": true, "TINYBLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+}
+
+// int64ByName returns an integer field. Bytes are parsed as text (numeric and text columns
+// returned by drivers as []byte) or, for 8-byte binary columns, as big-endian integer.
+func (m *Mapper) int64ByName(name string) (int64, error) {
 	v := m.fieldByName(name)
 	if v == nil {
-		return 0
+		return 0, nil
 	}
 	switch v.(type) {
 	case int64:
-		return v.(int64)
+		return v.(int64), nil
 	case uint64:
-		return int64(v.(uint64))
+		return int64(v.(uint64)), nil
 	case []byte:
-		return int64(binary.BigEndian.Uint64(v.([]byte)))
+		b := v.([]byte)
+		if i, ok := m.Map[name]; ok && i >= 0 && binaryTypes[m.Types[i]] {
+			if len(b) != 8 {
+				return 0, fmt.Errorf("%s: %d-byte binary value is not an integer", name, len(b))
+			}
+			return int64(binary.BigEndian.Uint64(b)), nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		return n, nil
 	}
-	return 0
+	return 0, nil
 }
 
 func (m *Mapper) hasField(name string) bool {
@@ -387,21 +567,26 @@ func (m *Mapper) hasField(name string) bool {
 }
 
 func buildQuery(pair *model.SyncPair) (query string, args []interface{}, outs []int64) {
+	if pair.OriginTable {
+		query, args = tableQuery(pair)
+		return
+	}
 	switch *pair.Source.Type {
 	case "postgres":
-		query = "select * from " + *pair.Origin + "("
-		n := 0
 		for p := range pair.ColumnParam {
-			if n > 0 {
-				query += ", "
-			}
-			query += strconv.FormatInt(pair.ColumnParam[p].Value, 10)
-			n++
+			args = append(args, pair.ColumnParam[p].Value)
 		}
-		query += ")"
+		query = "select * from " + quoteName("postgres", *pair.Origin) + "(" + placeholders("postgres", 1, len(args)) + ")"
+	case "mysql":
+		for p := range pair.ColumnParam {
+			args = append(args, pair.ColumnParam[p].Value)
+		}
+		query = "CALL " + quoteName("mysql", *pair.Origin) + "(" + placeholders("mysql", 1, len(args)) + ")"
+	case "sqlite":
+		query, args = sqliteQuery(pair)
 	case "mssql":
 		outs = make([]int64, len(pair.ColumnParam))
-		query = *pair.Origin
+		query = quoteName("mssql", *pair.Origin)
 		for p := range pair.ColumnParam {
 			var val interface{}
 			if pair.ColumnParam[p].BigEnd {
@@ -422,77 +607,122 @@ func buildQuery(pair *model.SyncPair) (query string, args []interface{}, outs []
 	return
 }
 
-func storeData(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, recordset int, heap []interface{}, pv []model.ColumnParamValue) error {
+// storeBatch stores recordset data along with RVs.
+// If the sync table is on destination side both are written in a single transaction,
+// so a recordset is applied exactly once. Otherwise data is committed first and RVs
+// are stored afterwards: a failure in between replays the recordset on the next run,
+// so destination procedures must be idempotent.
+func storeBatch(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, recordset int, heap []interface{}, pv []model.ColumnParamValue, log *slog.Logger) error {
+	if pair.SyncTableSide == "src" || dryRunFrom(ctx) != nil { // no transaction on target in dry run
+		if len(heap) > 0 {
+			err := storeData(ctx, dst, pair, recordset, heap, pv, log)
+			if err != nil {
+				metrics.Error(pair.Name, metrics.StageStore)
+				return err
+			}
+			metrics.RowsWritten(pair.Name, recordset, len(heap))
+		}
+		err := storeRV(ctx, src, pair, pv, log)
+		if err != nil {
+			metrics.Error(pair.Name, metrics.StageRV)
+		}
+		return err
+	}
+
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.Error(pair.Name, metrics.StageStore)
+		return err
+	}
+	if len(heap) > 0 {
+		err = storeData(ctx, tx, pair, recordset, heap, pv, log)
+		if err != nil {
+			metrics.Error(pair.Name, metrics.StageStore)
+		}
+	}
+	if err == nil {
+		err = storeRV(ctx, tx, pair, pv, log)
+		if err != nil {
+			metrics.Error(pair.Name, metrics.StageRV)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		metrics.Error(pair.Name, metrics.StageStore)
+		return err
+	}
+	metrics.RowsWritten(pair.Name, recordset, len(heap))
+	return nil
+}
+
+// advanceRV accepts new RV values as current
+func advanceRV(pair *model.SyncPair, pv []model.ColumnParamValue) {
+	copy(pair.ColumnParam, pv)
+	if pair.SyncTable == nil { // nested pairs: RVs are per parent row
+		return
+	}
+	for i := range pv {
+		metrics.RV(pair.Name, pv[i].Param, pv[i].Value)
+	}
+}
+
+// syncSide returns connection to the sync table
+func syncSide(src *sql.DB, dst *sql.DB, pair *model.SyncPair) *sql.DB {
+	if pair.SyncTableSide == "src" {
+		return src
+	}
+	return dst
+}
+
+func storeData(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}, pv []model.ColumnParamValue, log *slog.Logger) error {
 
 	if recordset >= len(pair.Dest) {
-		fmt.Println("not enough Dest procedures (extra recordset(s) encountered) in", *pair.Origin)
+		log.Warn("not enough Dest procedures, extra recordset skipped")
 		return nil
 	}
+	log.Debug("store", "dest", *pair.Dest[recordset], "rows", len(heap))
+	if dry := dryRunFrom(ctx); dry != nil {
+		return dry.data(ctx, dst, pair, recordset, heap)
+	}
 
-	var rows *sql.Rows
 	var err error
-
-	query := ""
+	if pair.Bulk != nil {
+		return storeBulk(ctx, dst, pair, recordset, heap)
+	}
+	if pair.DestTable[recordset] {
+		return storeTable(ctx, dst, pair, recordset, heap)
+	}
 	switch *pair.Target.Type {
 	case "postgres":
-		js, err := json.Marshal(heap)
+		var query string
+		var js []byte
+		query, js, err = postgresCall(pair, recordset, heap)
 		if err != nil {
 			return err
 		}
-		query = "select * from " + *pair.Dest[recordset] + "($1)"
+		var rows *sql.Rows
 		rows, err = dst.QueryContext(ctx, query, js)
-	case "mssql":
-		m := heap[0].(map[string]interface{})
-		// fix fields order
-		fields := make([]string, 0)
-		flds := make([]string, 0)
-		for k := range m {
-			fields = append(fields, "["+k+"]")
-			flds = append(flds, k)
+		if err == nil {
+			err = drain(rows)
 		}
+	case "mysql":
+		err = storeMySQL(ctx, dst, pair, recordset, heap)
+	case "sqlite":
+		err = storeSQLite(ctx, dst, pair, recordset, heap)
+	case "mssql":
 		if pair.TableType[recordset] != "" {
 			// call through table type
-			query += "DECLARE @tbl AS " + pair.TableType[recordset] + "\n"
-			// insert
-			query += "INSERT INTO @tbl (" + strings.Join(fields, ", ") + ")\n"
-			// select
-			query += "SELECT * FROM ( VALUES\n"
-			for i := range heap {
-				if i > 0 {
-					query += ","
-				}
-				m := heap[i].(map[string]interface{})
-				vals := valsTable(m, flds)
-				query += "(" + vals + ")\n"
-			}
-			query += ") t (" + strings.Join(fields, ", ") + ");\n"
-			query += "EXEC " + *pair.Dest[recordset] + " @tbl;"
+			err = storeTVP(ctx, dst, pair, recordset, heap)
 		} else {
 			// call with named parameters
-			for i := range heap {
-				m := heap[i].(map[string]interface{})
-				query += "EXEC " + *pair.Dest[recordset] + " " + valsList(m, flds) + ";\n"
-			}
+			err = storeNamed(ctx, dst, pair, recordset, heap)
 		}
-		rows, err = dst.QueryContext(ctx, query)
 	} // switch
 
-	if err != nil {
-		return err
-	}
-	if rows == nil {
-		return errors.New("rows == nil (probably destination proc does not exist)")
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		str := ""
-		err = rows.Scan(&str)
-		if err != nil {
-			return err
-		}
-	}
-	err = rows.Err()
 	if err != nil {
 		return err
 	}
@@ -506,64 +736,30 @@ func storeData(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPa
 	return nil
 }
 
-func valsTable(m map[string]interface{}, fields []string) (query string) {
-	for f := 0; f < len(fields); f++ {
-		if f > 0 {
-			query += ","
-		}
-		v := m[fields[f]]
-		switch v.(type) {
-		case *interface{}:
-			vv := v.(*interface{})
-			v = *vv
-		}
-		query += valEncode(v)
+// postgresCall returns Dest function call and its argument: the rows as a JSON array
+func postgresCall(pair *model.SyncPair, recordset int, heap []interface{}) (query string, js []byte, err error) {
+	js, err = json.Marshal(heap)
+	if err != nil {
+		return
 	}
+	query = "select * from " + quoteName("postgres", *pair.Dest[recordset]) + "($1)"
 	return
 }
 
-func valsList(m map[string]interface{}, fields []string) (query string) {
-	for f := 0; f < len(fields); f++ {
-		if f > 0 {
-			query += ", "
-		}
-		v := m[fields[f]]
-		switch v.(type) {
-		case *interface{}:
-			vv := v.(*interface{})
-			v = *vv
+// drain reads and closes all result sets returned by destination procedure
+func drain(rows *sql.Rows) error {
+	defer rows.Close()
+	for {
+		for rows.Next() {
 		}
-		val := "@" + fields[f] + "=" + valEncode(v)
-		query += val
-	}
-	return
-}
-
-func valEncode(v interface{}) (val string) {
-	switch v.(type) {
-	case int8, uint8,
-		int16, uint16,
-		int32, uint32,
-		int64, uint64,
-		float32, float64:
-		val = fmt.Sprintf("%v", v)
-	case string:
-		val = fmt.Sprintf("'%v'", strings.Replace(v.(string), "'", "''", -1))
-	case bool:
-		if v.(bool) {
-			val = "1"
-		} else {
-			val = "0"
+		if !rows.NextResultSet() {
+			break
 		}
-	case time.Time:
-		val = fmt.Sprintf("'%s'", (v.(time.Time)).Format("2006-01-02 15:04:05"))
-	default:
-		val = "null"
 	}
-	return
+	return rows.Err()
 }
 
-func storeRV(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair, pv []model.ColumnParamValue) error {
+func storeRV(ctx context.Context, sync execer, pair *model.SyncPair, pv []model.ColumnParamValue, log *slog.Logger) error {
 
 	changes := false
 	for i := 0; i < len(pv) && !changes; i++ {
@@ -571,71 +767,69 @@ func storeRV(ctx context.Context, src *sql.DB, dst *sql.DB, pair *model.SyncPair
 			changes = true
 		}
 	}
-	if !changes {
+	if !changes || pair.SyncTable == nil { // nested pairs have no sync table
 		return nil
 	}
-
-	var sync *sql.DB
-	if pair.SyncTableSide == "src" {
-		sync = src
-	} else {
-		sync = dst
+	if dry := dryRunFrom(ctx); dry != nil {
+		return dry.rv(pair, pv)
 	}
-	prms := ""
+
+	typ := syncType(pair)
+	table := quoteName(typ, *pair.SyncTable)
+	args := []interface{}{*pair.Origin}
 	for i := 0; i < len(pair.ColumnParam); i++ {
-		if len(prms) > 0 {
-			prms += ","
-		}
-		prms += "'" + pair.ColumnParam[i].Param + "'"
+		args = append(args, pair.ColumnParam[i].Param)
 	}
-	if pair.SyncTable == nil || pair.Origin == nil {
-		println("err")
-	}
-	query := "select param, value from " + *pair.SyncTable + " where tbl = '" + *pair.Origin + "' and param in (" + prms + ")"
-	rows, err := sync.QueryContext(ctx, query)
+	query := "select param, value from " + table + " where tbl = " + placeholder(typ, 1) +
+		" and param in (" + placeholders(typ, 2, len(pair.ColumnParam)) + ")"
+	existing, err := readRV(ctx, sync, query, args...)
 	if err != nil {
 		return err
 	}
+
+	for i := range pv {
+		if _, ok := existing[pv[i].Param]; ok {
+			query = "update " + table + " set value = " + placeholder(typ, 1) +
+				" where tbl = " + placeholder(typ, 2) + " and param = " + placeholder(typ, 3)
+			_, err = sync.ExecContext(ctx, query, pv[i].Value, *pair.Origin, pv[i].Param)
+		} else {
+			query = "insert into " + table + " (tbl, param, value) values (" + placeholders(typ, 1, 3) + ")"
+			_, err = sync.ExecContext(ctx, query, *pair.Origin, pv[i].Param, pv[i].Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	log.Debug("RV stored", rvAttr(pv))
+
+	return nil
+}
+
+// readRV reads stored RVs by param name. Rows are closed before return
+// so the connection (or transaction) may be reused for updates.
+func readRV(ctx context.Context, sync execer, query string, args ...interface{}) (map[string]int64, error) {
+	rows, err := sync.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	mapper, err := NewMapper(rows, map[string]string{"param": "param", "value": "value"}, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	saved := make(map[string]bool)
+	result := make(map[string]int64)
 	for rows.Next() {
 		err = rows.Scan(mapper.Vals...)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		// seek RV in memory
-		for i := range pv {
-			if pv[i].Param == mapper.stringByName("param") {
-				sql := "update " + *pair.SyncTable + " set value = " + strconv.FormatInt(pv[i].Value, 10) + " where tbl = '" + *pair.Origin + "' and param = '" + pv[i].Param + "'"
-				_, err := sync.Exec(sql)
-				if err != nil {
-					return err
-				}
-				saved[pv[i].Param] = true
-			}
-		}
-	}
-	err = rows.Err()
-	if err != nil {
-		return err
-	}
-	// insert absent
-	for i := range pv {
-		if _, ok := saved[pv[i].Param]; ok {
-			continue
-		}
-		sql := "insert into " + *pair.SyncTable + " (tbl, param, value) values ('" + *pair.Origin + "','" + pv[i].Param + "'," + strconv.FormatInt(pv[i].Value, 10) + ")"
-		_, err := sync.Exec(sql)
+		value, err := mapper.int64ByName("value")
 		if err != nil {
-			return err
+			return nil, err
 		}
+		result[mapper.stringByName("param")] = value
 	}
-
-	return nil
+	return result, rows.Err()
 }
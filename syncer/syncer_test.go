@@ -0,0 +1,142 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/bhmj/sqlsync/model"
+	_ "modernc.org/sqlite"
+)
+
+func TestReadRV(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // keep the in-memory database
+
+	ctx := context.Background()
+	if err := sqliteInit(ctx, db, "sqlsync"); err != nil {
+		t.Fatal(err)
+	}
+	// params stored as text and as blobs (MySQL drivers return varchar as []byte)
+	_, err = db.Exec(`insert into sqlsync (tbl, param, value) values
+		('items', 'rv', 42), ('items', cast('ts' as blob), 7), ('other', 'rv', 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readRV(ctx, db, "select param, value from sqlsync where tbl = ?", "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"rv": 42, "ts": 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readRV = %v, want %v", got, want)
+	}
+}
+
+func TestStringByName(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"rv", "rv"},
+		{[]byte("rv"), "rv"},
+		{int64(1), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		v := tt.value
+		m := &Mapper{Map: map[string]int{"param": 0}, Vals: []interface{}{&v}}
+		if got := m.stringByName("param"); got != tt.want {
+			t.Errorf("stringByName(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestInt64ByName(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		typ   string
+		want  int64
+		err   bool
+	}{
+		{int64(42), "BIGINT", 42, false},
+		{uint64(42), "BIGINT", 42, false},
+		{[]byte("42"), "DECIMAL", 42, false},
+		{[]byte("42"), "", 42, false},
+		{[]byte{0, 0, 0, 0, 0, 0, 0x10, 0x01}, "BINARY", 4097, false},
+		{[]byte("12345678"), "VARCHAR", 12345678, false},
+		{[]byte{0x10, 0x01}, "VARBINARY", 0, true},
+		{[]byte("4.2"), "DECIMAL", 0, true},
+		{nil, "BIGINT", 0, false},
+	}
+	for _, tt := range tests {
+		v := tt.value
+		m := &Mapper{Map: map[string]int{"rv": 0}, Vals: []interface{}{&v}, Types: []string{tt.typ}}
+		got, err := m.int64ByName("rv")
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("int64ByName(%#v, %s) = %d, %v, want %d (error %v)", tt.value, tt.typ, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestBatchAtRVBoundary(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`create table items (id integer primary key, rv integer);
+		insert into items values (1, 1), (2, 1), (3, 1), (4, 2), (5, 2), (6, 3)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := func(v string) *string { return &v }
+	link := &model.DBConnection{Type: "sqlite", DB: db}
+	pair := &model.SyncPair{Name: "items", Origin: s("items"), Dest: []*string{s("copy")}, Key: []string{"id"},
+		Source: model.DBServer{Type: s("sqlite")}, Target: model.DBServer{Type: s("sqlite")},
+		SourceLink: link, TargetLink: link, BatchSize: 2, SyncTable: s("sqlsync"), SyncTableSide: "dst",
+		OriginTable: true, DestTable: []bool{true},
+		ColumnParam: []model.ColumnParamValue{{Column: "rv", Param: "rv"}}}
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := DryRun(context.Background(), pair, &out, logger); err != nil {
+		t.Fatal(err)
+	}
+	var chunks []int
+	var rvs []int64
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var doc struct {
+			Statements []statement
+			RV         map[string]int64
+		}
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.RV != nil {
+			rvs = append(rvs, doc.RV["rv"])
+			continue
+		}
+		chunks = append(chunks, len(doc.Statements[0].Args)/2)
+	}
+	// a chunk of 2 is extended to the end of its RV value
+	if want := []int{3, 2, 1}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks = %v, want %v", chunks, want)
+	}
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(rvs, want) {
+		t.Errorf("RVs = %v, want %v", rvs, want)
+	}
+}
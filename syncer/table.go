@@ -0,0 +1,197 @@
+package syncer
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+// max bound parameters per statement
+var maxParams = map[string]int{
+	"postgres": 65000,
+	"mssql":    mssqlMaxParams,
+	"mysql":    65000,
+	"sqlite":   32000,
+}
+
+// SQL Server limits VALUES table constructor to 1000 rows
+const mssqlMaxRows = 1000
+
+// tableQuery selects rows from Origin table newer than watermark column values
+func tableQuery(pair *model.SyncPair) (query string, args []interface{}) {
+	typ := *pair.Source.Type
+	query = "select * from " + quoteName(typ, *pair.Origin)
+	order := make([]string, 0, len(pair.ColumnParam))
+	for i, p := range pair.ColumnParam {
+		if i == 0 {
+			query += " where "
+		} else {
+			query += " and "
+		}
+		col := quoteIdent(typ, p.Column)
+		query += col + " > " + placeholder(typ, i+1)
+		order = append(order, col)
+		if p.BigEnd {
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, uint64(p.Value))
+			args = append(args, buf)
+		} else {
+			args = append(args, p.Value)
+		}
+	}
+	if len(order) > 0 {
+		query += " order by " + strings.Join(order, ", ")
+	}
+	return
+}
+
+// storeTable upserts rows into Dest table keyed on pair.Key columns
+func storeTable(ctx context.Context, dst execer, pair *model.SyncPair, recordset int, heap []interface{}) error {
+	typ := *pair.Target.Type
+	table := quoteName(typ, *pair.Dest[recordset])
+	cols := heapColumns(heap)
+	if len(cols) == 0 {
+		return fmt.Errorf("no columns to store in %s", *pair.Dest[recordset])
+	}
+	heap = lastByKey(heap, pair.Key)
+
+	batch := maxParams[typ] / len(cols)
+	if typ == "mssql" && batch > mssqlMaxRows {
+		batch = mssqlMaxRows
+	}
+	if batch < 1 {
+		batch = 1
+	}
+	for start := 0; start < len(heap); start += batch {
+		end := start + batch
+		if end > len(heap) {
+			end = len(heap)
+		}
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(cols))
+		for _, r := range heap[start:end] {
+			m := r.(map[string]interface{})
+			for _, col := range cols {
+				args = append(args, paramValue(m[col]))
+			}
+			values = append(values, "("+placeholders(typ, len(args)-len(cols)+1, len(cols))+")")
+		}
+		query := upsertQuery(typ, table, cols, pair.Key, "VALUES "+strings.Join(values, ", "))
+		_, err := dst.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastByKey drops rows whose Key is repeated later in heap: an upsert cannot affect
+// the same row twice (Postgres ON CONFLICT, MS SQL MERGE), the last version wins anyway
+func lastByKey(heap []interface{}, keys []string) []interface{} {
+	if len(keys) == 0 {
+		return heap
+	}
+	last := make(map[string]int, len(heap))
+	for i, r := range heap {
+		last[rowKey(r.(map[string]interface{}), keys)] = i
+	}
+	if len(last) == len(heap) {
+		return heap
+	}
+	rows := make([]interface{}, 0, len(last))
+	for i, r := range heap {
+		if last[rowKey(r.(map[string]interface{}), keys)] == i {
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// rowKey returns Key values of a row as a string
+func rowKey(m map[string]interface{}, keys []string) string {
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%#v\x00", fieldByNameFold(m, k))
+	}
+	return sb.String()
+}
+
+// rvColumn returns the result column holding the watermark of a param.
+// Table columns are folded the same way tableQuery quotes them.
+func rvColumn(pair *model.SyncPair, p model.ColumnParamValue) string {
+	if pair.OriginTable {
+		return foldIdent(*pair.Source.Type, p.Column)
+	}
+	return p.Column
+}
+
+// upsertQuery returns dialect-specific upsert of source rows (VALUES or SELECT)
+func upsertQuery(typ string, table string, cols []string, keys []string, source string) string {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdent(typ, col)
+	}
+	isKey := make(map[string]bool)
+	for _, k := range keys {
+		isKey[strings.ToLower(k)] = true
+	}
+	list := strings.Join(quoted, ", ")
+
+	switch typ {
+	case "mssql":
+		on := make([]string, len(keys))
+		for i, k := range keys {
+			on[i] = "d." + quoteIdent(typ, k) + " = s." + quoteIdent(typ, k)
+		}
+		set := make([]string, 0, len(cols))
+		ins := make([]string, len(cols))
+		for i, col := range cols {
+			ins[i] = "s." + quoted[i]
+			if !isKey[strings.ToLower(col)] {
+				set = append(set, "d."+quoted[i]+" = s."+quoted[i])
+			}
+		}
+		query := "MERGE INTO " + table + " AS d USING (" + source + ") AS s (" + list + ")" +
+			" ON " + strings.Join(on, " AND ")
+		if len(set) > 0 {
+			query += " WHEN MATCHED THEN UPDATE SET " + strings.Join(set, ", ")
+		}
+		return query + " WHEN NOT MATCHED THEN INSERT (" + list + ") VALUES (" + strings.Join(ins, ", ") + ");"
+	case "mysql":
+		set := make([]string, 0, len(cols))
+		for i, col := range cols {
+			if !isKey[strings.ToLower(col)] {
+				set = append(set, quoted[i]+" = VALUES("+quoted[i]+")")
+			}
+		}
+		if len(set) == 0 {
+			return "INSERT IGNORE INTO " + table + " (" + list + ") " + source
+		}
+		return "INSERT INTO " + table + " (" + list + ") " + source +
+			" ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+	}
+
+	// postgres, sqlite
+	target := ""
+	if len(keys) > 0 {
+		qkeys := make([]string, len(keys))
+		for i, k := range keys {
+			qkeys[i] = quoteIdent(typ, k)
+		}
+		target = " (" + strings.Join(qkeys, ", ") + ")"
+	}
+	set := make([]string, 0, len(cols))
+	for i, col := range cols {
+		if !isKey[strings.ToLower(col)] {
+			set = append(set, quoted[i]+" = excluded."+quoted[i])
+		}
+	}
+	query := "insert into " + table + " (" + list + ") " + source + " on conflict" + target
+	if len(set) == 0 {
+		return query + " do nothing"
+	}
+	return query + " do update set " + strings.Join(set, ", ")
+}
@@ -0,0 +1,82 @@
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bhmj/sqlsync/model"
+)
+
+func TestStoreTable(t *testing.T) {
+	s := func(v string) *string { return &v }
+	row := func(id int64, name string) interface{} {
+		return map[string]interface{}{"id": id, "name": name}
+	}
+	tests := []struct {
+		name  string
+		typ   string
+		heap  []interface{}
+		query string
+		args  []interface{}
+		err   bool
+	}{
+		{"postgres duplicate keys", "postgres", []interface{}{row(1, "a"), row(2, "b"), row(1, "c")},
+			`insert into "items" ("id", "name") VALUES ($1, $2), ($3, $4) on conflict ("id") do update set "name" = excluded."name"`,
+			[]interface{}{int64(2), "b", int64(1), "c"}, false},
+		{"mssql duplicate keys", "mssql", []interface{}{row(1, "a"), row(1, "b")},
+			"MERGE INTO [items] AS d USING (VALUES (@p1, @p2)) AS s ([id], [name]) ON d.[ID] = s.[ID]" +
+				" WHEN MATCHED THEN UPDATE SET d.[name] = s.[name] WHEN NOT MATCHED THEN INSERT ([id], [name]) VALUES (s.[id], s.[name]);",
+			[]interface{}{int64(1), "b"}, false},
+		{"no columns", "postgres", []interface{}{map[string]interface{}{}}, "", nil, true},
+	}
+	for _, tt := range tests {
+		key := "id"
+		if tt.typ == "mssql" {
+			key = "ID" // keys match columns case-insensitively
+		}
+		pair := &model.SyncPair{Target: model.DBServer{Type: s(tt.typ)}, Dest: []*string{s("items")}, Key: []string{key}}
+		rec := &recorder{}
+		err := storeTable(context.Background(), rec, pair, 0, tt.heap)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: want error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(rec.stmts) != 1 {
+			t.Errorf("%s: %d statements, want 1", tt.name, len(rec.stmts))
+			continue
+		}
+		if rec.stmts[0].Query != tt.query {
+			t.Errorf("%s: query\n%s\nwant\n%s", tt.name, rec.stmts[0].Query, tt.query)
+		}
+		if !reflect.DeepEqual(rec.stmts[0].Args, tt.args) {
+			t.Errorf("%s: args %v, want %v", tt.name, rec.stmts[0].Args, tt.args)
+		}
+	}
+}
+
+func TestRVColumn(t *testing.T) {
+	s := func(v string) *string { return &v }
+	p := model.ColumnParamValue{Column: "UpdatedAt", Param: "rv"}
+	tests := []struct {
+		typ   string
+		table bool
+		want  string
+	}{
+		{"postgres", true, "updatedat"},
+		{"postgres", false, "UpdatedAt"},
+		{"mssql", true, "UpdatedAt"},
+	}
+	for _, tt := range tests {
+		pair := &model.SyncPair{Source: model.DBServer{Type: s(tt.typ)}, OriginTable: tt.table}
+		if got := rvColumn(pair, p); got != tt.want {
+			t.Errorf("rvColumn(%s, table %v) = %s, want %s", tt.typ, tt.table, got, tt.want)
+		}
+	}
+}